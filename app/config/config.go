@@ -0,0 +1,361 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the gateway configuration. Every field is read from the YAML
+// file by its yaml key, then from .env and the environment by its env key,
+// each source overriding the previous one. Fields marked reload:"restart"
+// only take effect on restart, the others are applied by a reload.
+type Config struct {
+	APIKey string `yaml:"api_key" env:"API_KEY"`
+
+	// AdminAPIKey is the only configured key with the admin scope, API_KEY
+	// is shared with the integrations and can't manage the gateway.
+	AdminAPIKey    string `yaml:"admin_api_key" env:"ADMIN_API_KEY"`
+	AuthAllowQuery bool   `yaml:"auth_allow_query" env:"AUTH_ALLOW_QUERY"`
+	// RateLimit is the number of API requests per minute allowed per key,
+	// 0 disables the limit.
+	RateLimit int `yaml:"rate_limit" env:"RATE_LIMIT"`
+
+	ProxyURL       string `yaml:"proxy_url" env:"PROXY_URL"`
+	StatusProxyURL string `yaml:"status_proxy_url" env:"STATUS_PROXY_URL"`
+	// HistoryProxyURL receives the messages of the history sync after pairing.
+	HistoryProxyURL string `yaml:"history_proxy_url" env:"HISTORY_PROXY_URL"`
+
+	LogLevel  string `yaml:"log_level" env:"LOG_LEVEL"`
+	LogFormat string `yaml:"log_format" env:"LOG_FORMAT" reload:"restart"`
+	// LogRedact masks phone numbers and hides message bodies in the logs.
+	LogRedact bool `yaml:"log_redact" env:"LOG_REDACT"`
+
+	Port        string `yaml:"port" env:"PORT" reload:"restart"`
+	AdminListen string `yaml:"admin_listen" env:"ADMIN_LISTEN" reload:"restart"`
+	AutoLogin   bool   `yaml:"auto_login" env:"AUTO_LOGIN" reload:"restart"`
+	// BinaryName is only read by start.sh and mac.sh, which build the
+	// gateway under this name and find its process by it. The gateway itself
+	// ignores it.
+	BinaryName string `yaml:"binary_name" env:"BINARY_NAME" reload:"restart"`
+	GatewayDB  string `yaml:"gateway_db" env:"GATEWAY_DB" reload:"restart"`
+	PIDFile    string `yaml:"pid_file" env:"PID_FILE" reload:"restart"`
+
+	// ContactCacheTTL is in seconds.
+	ContactCacheTTL int `yaml:"contact_cache_ttl" env:"CONTACT_CACHE_TTL"`
+	// EventRetentionHours is how long streamed events are kept for resuming.
+	EventRetentionHours int `yaml:"event_retention_hours" env:"EVENT_RETENTION_HOURS"`
+
+	MediaPath        string `yaml:"media_path" env:"MEDIA_PATH" reload:"restart"`
+	MediaQuotaMB     int64  `yaml:"media_quota_mb" env:"MEDIA_QUOTA_MB" reload:"restart"`
+	MediaWebhookMode string `yaml:"media_webhook_mode" env:"MEDIA_WEBHOOK_MODE"`
+	MediaBaseURL     string `yaml:"media_base_url" env:"MEDIA_BASE_URL"`
+	// FFmpegPath is an ffmpeg binary for voice note transcoding and video
+	// thumbnails. Without it videos get a blank preview and voice notes must
+	// already be Ogg Opus.
+	FFmpegPath string `yaml:"ffmpeg_path" env:"FFMPEG_PATH"`
+
+	// MediaFetchTimeout is in seconds.
+	MediaFetchTimeout      int      `yaml:"media_fetch_timeout" env:"MEDIA_FETCH_TIMEOUT"`
+	MediaFetchMaxMB        int64    `yaml:"media_fetch_max_mb" env:"MEDIA_FETCH_MAX_MB"`
+	MediaFetchAllowHosts   []string `yaml:"media_fetch_allow_hosts" env:"MEDIA_FETCH_ALLOW_HOSTS"`
+	MediaFetchDenyHosts    []string `yaml:"media_fetch_deny_hosts" env:"MEDIA_FETCH_DENY_HOSTS"`
+	MediaFetchAllowPrivate bool     `yaml:"media_fetch_allow_private" env:"MEDIA_FETCH_ALLOW_PRIVATE"`
+	// MediaFetchHeaders holds per host headers as "host|Name: value" entries
+	// separated by semicolons.
+	MediaFetchHeaders string `yaml:"media_fetch_headers" env:"MEDIA_FETCH_HEADERS"`
+}
+
+func defaults() *Config {
+	return &Config{
+		AuthAllowQuery:      true,
+		LogFormat:           "text",
+		LogRedact:           true,
+		GatewayDB:           "gateway.db",
+		ContactCacheTTL:     600,
+		EventRetentionHours: 72,
+		MediaFetchTimeout:   30,
+		MediaFetchMaxMB:     100,
+	}
+}
+
+var logLevels = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+// Validate checks the values that would otherwise only fail when used.
+func (c *Config) Validate() error {
+	var problems []string
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port <= 0 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT must be a port number, got %q", c.Port))
+	}
+
+	// An empty level logs everything, as waLog does.
+	c.LogLevel = strings.ToUpper(c.LogLevel)
+	if c.LogLevel != "" && !contains(logLevels, c.LogLevel) {
+		problems = append(problems, fmt.Sprintf("LOG_LEVEL must be one of %s, got %q", strings.Join(logLevels, ", "), c.LogLevel))
+	}
+
+	for _, setting := range []struct{ name, value string }{
+		{"PROXY_URL", c.ProxyURL},
+		{"STATUS_PROXY_URL", c.StatusProxyURL},
+		{"HISTORY_PROXY_URL", c.HistoryProxyURL},
+		{"MEDIA_BASE_URL", c.MediaBaseURL},
+	} {
+		name, value := setting.name, setting.value
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("%s must be an http(s) URL, got %q", name, value))
+		}
+	}
+
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		problems = append(problems, fmt.Sprintf("LOG_FORMAT must be text or json, got %q", c.LogFormat))
+	}
+
+	if c.MediaWebhookMode != "" && c.MediaWebhookMode != "inline" && c.MediaWebhookMode != "url" {
+		problems = append(problems, fmt.Sprintf("MEDIA_WEBHOOK_MODE must be inline or url, got %q", c.MediaWebhookMode))
+	}
+
+	if c.RateLimit < 0 {
+		problems = append(problems, "RATE_LIMIT must not be negative")
+	}
+	if c.ContactCacheTTL < 0 {
+		problems = append(problems, "CONTACT_CACHE_TTL must not be negative")
+	}
+	if c.EventRetentionHours <= 0 {
+		problems = append(problems, "EVENT_RETENTION_HOURS must be positive")
+	}
+	if c.MediaQuotaMB < 0 {
+		problems = append(problems, "MEDIA_QUOTA_MB must not be negative")
+	}
+	if c.MediaFetchTimeout <= 0 {
+		problems = append(problems, "MEDIA_FETCH_TIMEOUT must be positive")
+	}
+	if c.MediaFetchMaxMB <= 0 {
+		problems = append(problems, "MEDIA_FETCH_MAX_MB must be positive")
+	}
+
+	if _, err := c.FetchHeaders(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// FetchHeaders parses MediaFetchHeaders into headers by lowercase host.
+func (c *Config) FetchHeaders() (map[string]map[string]string, error) {
+	headers := make(map[string]map[string]string)
+
+	for _, entry := range strings.Split(c.MediaFetchHeaders, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		host, header, ok := strings.Cut(entry, "|")
+		name, value, ok2 := strings.Cut(header, ":")
+		if !ok || !ok2 || strings.TrimSpace(host) == "" || strings.TrimSpace(name) == "" {
+			return nil, errors.New("invalid MEDIA_FETCH_HEADERS entry for host " + strings.TrimSpace(host))
+		}
+		host = strings.ToLower(strings.TrimSpace(host))
+		if headers[host] == nil {
+			headers[host] = make(map[string]string)
+		}
+		headers[host][strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	return headers, nil
+}
+
+// RestartRequired lists the env keys of the settings that differ between
+// old and c but only take effect on restart.
+func (c *Config) RestartRequired(old *Config) []string {
+	keys := []string{}
+
+	oldValue, newValue := reflect.ValueOf(old).Elem(), reflect.ValueOf(c).Elem()
+	fields := newValue.Type()
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		if field.Tag.Get("reload") != "restart" {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			keys = append(keys, field.Tag.Get("env"))
+		}
+	}
+
+	return keys
+}
+
+// Read builds the configuration from the defaults, the YAML file, the .env
+// file and the environment, and validates it. Missing files are skipped.
+func Read(envFile, yamlFile string) (*Config, error) {
+	cfg := defaults()
+
+	if yamlFile != "" {
+		data, err := os.ReadFile(yamlFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := yaml.Unmarshal(data, cfg); err != nil {
+				return nil, fmt.Errorf("%s: %w", yamlFile, err)
+			}
+		}
+	}
+
+	values := make(map[string]string)
+	if envFile != "" {
+		fileValues, err := godotenv.Read(envFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s: %w", envFile, err)
+		}
+		for key, value := range fileValues {
+			values[key] = value
+		}
+	}
+
+	if err := apply(cfg, values); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// apply sets the fields found in values or the environment, the environment
+// taking precedence.
+func apply(cfg *Config, values map[string]string) error {
+	value := reflect.ValueOf(cfg).Elem()
+	fields := value.Type()
+
+	for i := 0; i < fields.NumField(); i++ {
+		key := fields.Field(i).Tag.Get("env")
+
+		raw, ok := os.LookupEnv(key)
+		if !ok {
+			raw, ok = values[key]
+		}
+		if !ok {
+			continue
+		}
+
+		if err := setField(value.Field(i), strings.TrimSpace(raw)); err != nil {
+			return fmt.Errorf("invalid %s %q: %w", key, raw, err)
+		}
+	}
+
+	return nil
+}
+
+func setField(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		if raw == "" {
+			field.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("expected 0 or 1")
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		if raw == "" {
+			return nil
+		}
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return errors.New("expected a number")
+		}
+		field.SetInt(n)
+	case reflect.Slice:
+		field.Set(reflect.ValueOf(splitList(raw)))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Manager holds the active configuration. Reload swaps it atomically, so
+// readers always see a complete, validated configuration.
+type Manager struct {
+	envFile, yamlFile string
+
+	mu     sync.Mutex
+	config atomic.Value
+}
+
+func Load(envFile, yamlFile string) (*Manager, error) {
+	cfg, err := Read(envFile, yamlFile)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{envFile: envFile, yamlFile: yamlFile}
+	m.config.Store(cfg)
+
+	return m, nil
+}
+
+// Get returns the active configuration, which must not be modified.
+func (m *Manager) Get() *Config {
+	return m.config.Load().(*Config)
+}
+
+// Reload reads the configuration again. An invalid configuration is
+// rejected and the active one is kept.
+func (m *Manager) Reload() (old *Config, current *Config, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cfg, err := Read(m.envFile, m.yamlFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	old = m.Get()
+	m.config.Store(cfg)
+
+	return old, cfg, nil
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/logging"
+	"github.com/hiddensetup/w/app/store"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+var auditCSVHeader = []string{"id", "time", "request_id", "key_id", "key_name", "ip", "action", "method", "path", "target", "status", "success", "error"}
+
+// AuditLog lists audit entries, newest first. since and until take RFC 3339
+// times or dates, key, action and target filter by exact value. format=csv
+// or format=jsonl exports all matching entries as a download, without the
+// default limit.
+func (k *Controller) AuditLog(c *fiber.Ctx) error {
+	filter := store.AuditFilter{
+		KeyID:  c.Query(`key`),
+		Action: c.Query(`action`),
+		Target: c.Query(`target`),
+		Offset: c.QueryInt(`offset`, 0),
+	}
+
+	var err error
+	if filter.Since, err = parseAuditTime(c.Query(`since`)); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+	if filter.Until, err = parseAuditTime(c.Query(`until`)); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+	if filter.Offset < 0 {
+		return fail(c, fiber.StatusBadRequest, errors.New("offset must not be negative"))
+	}
+
+	format := c.Query(`format`, `json`)
+	switch format {
+	case `json`:
+		filter.Limit = c.QueryInt(`limit`, defaultAuditLimit)
+		if filter.Limit <= 0 || filter.Limit > maxAuditLimit {
+			filter.Limit = maxAuditLimit
+		}
+
+		entries := []store.AuditEntry{}
+		err := k.store.AuditEntries(filter, func(entry store.AuditEntry) error {
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			return fail(c, fiber.StatusInternalServerError, err)
+		}
+
+		return c.JSON(entries)
+	case `csv`, `jsonl`:
+		filter.Limit = c.QueryInt(`limit`, 0)
+		return k.exportAudit(c, filter, format)
+	default:
+		return fail(c, fiber.StatusBadRequest, errors.New("format must be json, csv or jsonl"))
+	}
+}
+
+func (k *Controller) exportAudit(c *fiber.Ctx, filter store.AuditFilter, format string) error {
+	filename := "audit-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	if format == `csv` {
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	} else {
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	}
+	c.Attachment(filename)
+
+	logger := logging.FromContext(c.UserContext())
+
+	// Entries are streamed, an export may be larger than is reasonable to
+	// hold in memory.
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var err error
+		if format == `csv` {
+			err = writeAuditCSV(w, k.store, filter)
+		} else {
+			err = writeAuditJSONL(w, k.store, filter)
+		}
+		if err != nil {
+			logger.Error("Exporting audit log failed", "error", err)
+		}
+		w.Flush()
+	})
+
+	return nil
+}
+
+func writeAuditCSV(w *bufio.Writer, audit *store.Store, filter store.AuditFilter) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(auditCSVHeader); err != nil {
+		return err
+	}
+
+	err := audit.AuditEntries(filter, func(entry store.AuditEntry) error {
+		return writer.Write([]string{
+			strconv.FormatInt(entry.ID, 10),
+			entry.Time.UTC().Format(time.RFC3339Nano),
+			csvCell(entry.RequestID),
+			csvCell(entry.KeyID),
+			csvCell(entry.KeyName),
+			csvCell(entry.IP),
+			csvCell(entry.Action),
+			csvCell(entry.Method),
+			csvCell(entry.Path),
+			csvCell(entry.Target),
+			strconv.Itoa(entry.Status),
+			strconv.FormatBool(entry.Success),
+			csvCell(entry.Error),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvCell keeps spreadsheets from running a cell as a formula, request paths
+// and targets come from API clients. Spreadsheets hide the leading quote.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+func writeAuditJSONL(w *bufio.Writer, audit *store.Store, filter store.AuditFilter) error {
+	encoder := json.NewEncoder(w)
+
+	return audit.AuditEntries(filter, func(entry store.AuditEntry) error {
+		return encoder.Encode(entry)
+	})
+}
+
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, errors.New("invalid time, use RFC 3339 or YYYY-MM-DD: " + value)
+}
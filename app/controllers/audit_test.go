@@ -0,0 +1,25 @@
+package controllers
+
+import "testing"
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"/api/message", "/api/message"},
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+5511999999999", "'+5511999999999"},
+		{"-1+1", "'-1+1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"a=1", "a=1"},
+	}
+
+	for _, tt := range tests {
+		if got := csvCell(tt.value); got != tt.want {
+			t.Errorf("csvCell(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
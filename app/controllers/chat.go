@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+	"github.com/hiddensetup/w/app/store"
+	"go.mau.fi/whatsmeow/appstate"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// ArchiveChat archives or unarchives a chat on all linked devices.
+func (k *Controller) ArchiveChat(c *fiber.Ctx) error {
+	req := dto.ArchiveChatRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	return k.patchChat(c, func(chat types.JID) (appstate.PatchInfo, error) {
+		timestamp, key, err := k.lastMessageKey(chat)
+		return appstate.BuildArchive(chat, req.Archive, timestamp, key), err
+	})
+}
+
+func (k *Controller) PinChat(c *fiber.Ctx) error {
+	req := dto.PinChatRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	return k.patchChat(c, func(chat types.JID) (appstate.PatchInfo, error) {
+		return appstate.BuildPin(chat, req.Pin), nil
+	})
+}
+
+func (k *Controller) MuteChat(c *fiber.Ctx) error {
+	req := dto.MuteChatRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	var duration time.Duration
+	if req.Mute && req.Until != "" {
+		until, err := time.Parse(time.RFC3339, req.Until)
+		if err != nil {
+			return fail(c, fiber.StatusBadRequest, errors.New("until must be an RFC 3339 time"))
+		}
+		if duration = time.Until(until); duration <= 0 {
+			return fail(c, fiber.StatusBadRequest, errors.New("until must be in the future"))
+		}
+	}
+
+	return k.patchChat(c, func(chat types.JID) (appstate.PatchInfo, error) {
+		patch := appstate.BuildMute(chat, req.Mute, duration)
+		if req.Mute && duration == 0 {
+			// WhatsApp mutes for good with -1, BuildMute leaves it out.
+			patch.Mutations[0].Value.MuteAction.MuteEndTimestamp = proto.Int64(-1)
+		}
+		return patch, nil
+	})
+}
+
+// MarkChat marks a whole chat read or unread, like the chat list does. To
+// send read receipts for messages use MarkRead.
+func (k *Controller) MarkChat(c *fiber.Ctx) error {
+	req := dto.MarkChatRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	// whatsmeow has no builder for this one.
+	return k.patchChat(c, func(chat types.JID) (appstate.PatchInfo, error) {
+		messageRange, err := k.messageRange(chat)
+		return appstate.PatchInfo{
+			Type: appstate.WAPatchRegularLow,
+			Mutations: []appstate.MutationInfo{{
+				Index:   []string{appstate.IndexMarkChatAsRead, chat.String()},
+				Version: 3,
+				Value: &waProto.SyncActionValue{
+					MarkChatAsReadAction: &waProto.MarkChatAsReadAction{
+						Read:         proto.Bool(req.Read),
+						MessageRange: messageRange,
+					},
+				},
+			}},
+		}, err
+	})
+}
+
+// ClearChat deletes the messages of a chat but keeps it in the chat list.
+func (k *Controller) ClearChat(c *fiber.Ctx) error {
+	return k.patchChat(c, func(chat types.JID) (appstate.PatchInfo, error) {
+		messageRange, err := k.messageRange(chat)
+		return appstate.PatchInfo{
+			Type: appstate.WAPatchRegularHigh,
+			Mutations: []appstate.MutationInfo{{
+				// Keep starred messages, delete the media.
+				Index:   []string{appstate.IndexClearChat, chat.String(), "0", "1"},
+				Version: 6,
+				Value: &waProto.SyncActionValue{
+					ClearChatAction: &waProto.ClearChatAction{MessageRange: messageRange},
+				},
+			}},
+		}, err
+	})
+}
+
+// DeleteChat removes a chat and its media from the chat list.
+func (k *Controller) DeleteChat(c *fiber.Ctx) error {
+	return k.patchChat(c, func(chat types.JID) (appstate.PatchInfo, error) {
+		messageRange, err := k.messageRange(chat)
+		return appstate.PatchInfo{
+			Type: appstate.WAPatchRegularHigh,
+			Mutations: []appstate.MutationInfo{{
+				Index:   []string{appstate.IndexDeleteChat, chat.String(), "1"},
+				Version: 6,
+				Value: &waProto.SyncActionValue{
+					DeleteChatAction: &waProto.DeleteChatAction{MessageRange: messageRange},
+				},
+			}},
+		}, err
+	})
+}
+
+// patchChat builds an app state patch for the :jid chat and sends it, which
+// syncs the change to the phone and the other linked devices.
+func (k *Controller) patchChat(c *fiber.Ctx, build func(chat types.JID) (appstate.PatchInfo, error)) error {
+	chat, ok := parseJID(c.Params(`jid`))
+	if !ok {
+		return fail(c, fiber.StatusBadRequest, errors.New("invalid jid"))
+	}
+
+	patch, err := build(chat)
+	if err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	if err := k.client.SendAppState(patch); err != nil {
+		logging.FromContext(c.UserContext()).Error("Updating chat failed", "chat", chat.String(), "error", err)
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
+
+// lastMessageKey looks up the newest stored message of the chat, which
+// archiving and marking read need to tell which messages they cover. Chats
+// without stored messages cover everything up to now.
+func (k *Controller) lastMessageKey(chat types.JID) (time.Time, *waProto.MessageKey, error) {
+	msg, err := k.store.LatestMessage(chat.String())
+	if errors.Is(err, store.ErrNotFound) {
+		return time.Now(), nil, nil
+	} else if err != nil {
+		return time.Time{}, nil, err
+	}
+
+	key := &waProto.MessageKey{
+		RemoteJID: proto.String(msg.Chat),
+		FromMe:    proto.Bool(msg.IsFromMe),
+		ID:        proto.String(msg.ID),
+	}
+	if msg.IsGroup && !msg.IsFromMe {
+		key.Participant = proto.String(msg.Sender)
+	}
+
+	return msg.Timestamp, key, nil
+}
+
+func (k *Controller) messageRange(chat types.JID) (*waProto.SyncActionMessageRange, error) {
+	timestamp, key, err := k.lastMessageKey(chat)
+	if err != nil {
+		return nil, err
+	}
+
+	messageRange := &waProto.SyncActionMessageRange{LastMessageTimestamp: proto.Int64(timestamp.Unix())}
+	if key != nil {
+		messageRange.Messages = []*waProto.SyncActionMessage{{Key: key, Timestamp: proto.Int64(timestamp.Unix())}}
+	}
+
+	return messageRange, nil
+}
+
+// chatEvent converts the chat changes made on the phone. Changes replayed by
+// a full app state sync are skipped, they aren't news.
+func chatEvent(evt interface{}) (dto.ChatEvent, bool) {
+	switch v := evt.(type) {
+	case *events.Archive:
+		return dto.ChatEvent{Event: "chat_archive", JID: v.JID.String(), Value: v.Action.GetArchived(),
+			Timestamp: v.Timestamp.String()}, !v.FromFullSync
+	case *events.Pin:
+		return dto.ChatEvent{Event: "chat_pin", JID: v.JID.String(), Value: v.Action.GetPinned(),
+			Timestamp: v.Timestamp.String()}, !v.FromFullSync
+	case *events.Mute:
+		event := dto.ChatEvent{Event: "chat_mute", JID: v.JID.String(), Value: v.Action.GetMuted(),
+			Timestamp: v.Timestamp.String()}
+		if end := v.Action.GetMuteEndTimestamp(); v.Action.GetMuted() && end > 0 {
+			event.MutedUntil = time.UnixMilli(end).String()
+		}
+		return event, !v.FromFullSync
+	case *events.MarkChatAsRead:
+		return dto.ChatEvent{Event: "chat_read", JID: v.JID.String(), Value: v.Action.GetRead(),
+			Timestamp: v.Timestamp.String()}, !v.FromFullSync
+	case *events.ClearChat:
+		return dto.ChatEvent{Event: "chat_clear", JID: v.JID.String(), Value: true,
+			Timestamp: v.Timestamp.String()}, !v.FromFullSync
+	case *events.DeleteChat:
+		return dto.ChatEvent{Event: "chat_delete", JID: v.JID.String(), Value: true,
+			Timestamp: v.Timestamp.String()}, !v.FromFullSync
+	}
+
+	return dto.ChatEvent{}, false
+}
@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+	"go.mau.fi/whatsmeow"
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/types"
+)
+
+const maxAvatarSize = 5 << 20
+
+var avatarClient = &http.Client{Timeout: time.Second * 15}
+
+type contactCacheEntry struct {
+	profile dto.ContactProfile
+	expires time.Time
+}
+
+// contactCache keeps looked up profiles for CONTACT_CACHE_TTL seconds so the
+// agents' UI doesn't hit WhatsApp with three queries per rendered contact.
+type contactCache struct {
+	mu      sync.Mutex
+	entries map[types.JID]contactCacheEntry
+	ttl     func() time.Duration
+}
+
+func newContactCache(ttl func() time.Duration) *contactCache {
+	return &contactCache{entries: make(map[types.JID]contactCacheEntry), ttl: ttl}
+}
+
+func (cc *contactCache) get(jid types.JID) (dto.ContactProfile, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	entry, ok := cc.entries[jid]
+	if !ok || time.Now().After(entry.expires) {
+		delete(cc.entries, jid)
+		return dto.ContactProfile{}, false
+	}
+
+	return entry.profile, true
+}
+
+func (cc *contactCache) put(jid types.JID, profile dto.ContactProfile) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.entries[jid] = contactCacheEntry{profile: profile, expires: time.Now().Add(cc.ttl())}
+}
+
+func (k *Controller) contactCacheTTL() time.Duration {
+	return time.Duration(k.config.Get().ContactCacheTTL) * time.Second
+}
+
+// Contacts lists the address book whatsmeow keeps in its store. The q query
+// parameter filters by JID or any of the known names, case-insensitively.
+func (k *Controller) Contacts(c *fiber.Ctx) error {
+	all, err := k.client.Store.Contacts.GetAllContacts()
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Listing contacts failed", "error", err)
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+
+	query := strings.ToLower(strings.TrimSpace(c.Query(`q`)))
+
+	contacts := make([]dto.Contact, 0, len(all))
+	for jid, info := range all {
+		contact := dto.Contact{
+			JID:          jid.String(),
+			Found:        info.Found,
+			FirstName:    info.FirstName,
+			FullName:     info.FullName,
+			PushName:     info.PushName,
+			BusinessName: info.BusinessName,
+		}
+
+		if query != "" && !contactMatches(contact, query) {
+			continue
+		}
+
+		contacts = append(contacts, contact)
+	}
+
+	sort.Slice(contacts, func(i, j int) bool {
+		return contacts[i].JID < contacts[j].JID
+	})
+
+	offset := c.QueryInt(`offset`, 0)
+	limit := c.QueryInt(`limit`, len(contacts))
+	if offset < 0 || offset > len(contacts) {
+		offset = len(contacts)
+	}
+	if limit < 0 || limit > len(contacts)-offset {
+		limit = len(contacts) - offset
+	}
+
+	return c.JSON(contacts[offset : offset+limit])
+}
+
+func contactMatches(contact dto.Contact, query string) bool {
+	for _, field := range []string{contact.JID, contact.FirstName, contact.FullName, contact.PushName, contact.BusinessName} {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (k *Controller) ContactProfile(c *fiber.Ctx) error {
+	jid, ok := parseJID(c.Params(`jid`))
+	if !ok {
+		return fail(c, fiber.StatusBadRequest, errors.New("invalid jid"))
+	}
+
+	if c.Query(`refresh`) != `1` {
+		if profile, ok := k.contacts.get(jid); ok {
+			return c.JSON(profile)
+		}
+	}
+
+	profile, err := k.lookupContact(jid)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Looking up contact failed", "jid", jid.String(), "error", err)
+		return fail(c, errorStatus(err), err)
+	}
+
+	k.contacts.put(jid, profile)
+
+	return c.JSON(profile)
+}
+
+// ContactAvatar downloads the contact's profile picture and proxies it, so
+// consumers don't need to reach the WhatsApp CDN or handle expiring URLs.
+func (k *Controller) ContactAvatar(c *fiber.Ctx) error {
+	jid, ok := parseJID(c.Params(`jid`))
+	if !ok {
+		return fail(c, fiber.StatusBadRequest, errors.New("invalid jid"))
+	}
+
+	pic, err := k.client.GetProfilePictureInfo(jid, &whatsmeow.GetProfilePictureParams{
+		Preview: c.Query(`preview`) == `1`,
+	})
+	if err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+	if pic == nil || pic.URL == "" {
+		return fail(c, fiber.StatusNotFound, whatsmeow.ErrProfilePictureNotSet)
+	}
+
+	resp, err := avatarClient.Get(pic.URL)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Downloading avatar failed", "jid", jid.String(), "error", err)
+		return fail(c, fiber.StatusBadGateway, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fail(c, fiber.StatusBadGateway, errors.New("avatar download failed: "+resp.Status))
+	}
+
+	// Read one byte past the limit to tell a full avatar from a cut one.
+	image, err := io.ReadAll(io.LimitReader(resp.Body, maxAvatarSize+1))
+	if err != nil {
+		return fail(c, fiber.StatusBadGateway, err)
+	}
+	if len(image) > maxAvatarSize {
+		return fail(c, fiber.StatusBadGateway, errors.New("avatar is larger than 5 MB"))
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "image/jpeg"
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, "private, max-age="+strconv.Itoa(k.config.Get().ContactCacheTTL))
+	c.Set(fiber.HeaderETag, `"`+pic.ID+`"`)
+
+	return c.Send(image)
+}
+
+func (k *Controller) lookupContact(jid types.JID) (dto.ContactProfile, error) {
+	profile := dto.ContactProfile{JID: jid.String()}
+
+	users, err := k.client.GetUserInfo([]types.JID{jid})
+	if err != nil {
+		return profile, err
+	}
+
+	if info, ok := users[jid.ToNonAD()]; ok {
+		profile.About = info.Status
+		profile.PictureID = info.PictureID
+
+		if info.VerifiedName != nil && info.VerifiedName.Details != nil {
+			profile.IsBusiness = true
+			profile.VerifiedName = info.VerifiedName.Details.GetVerifiedName()
+		}
+	}
+
+	pic, err := k.client.GetProfilePictureInfo(jid, &whatsmeow.GetProfilePictureParams{})
+	switch {
+	case err == nil && pic != nil:
+		profile.PictureID = pic.ID
+		profile.PictureURL = pic.URL
+	case errors.Is(err, whatsmeow.ErrProfilePictureNotSet),
+		errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized):
+		// No picture or hidden by the contact's privacy settings.
+	case err != nil:
+		return profile, err
+	}
+
+	if profile.IsBusiness {
+		business, err := k.getBusinessProfile(jid)
+		if err != nil {
+			// The business profile is optional extra data, don't fail the lookup.
+			slog.Warn("Fetching business profile failed", "jid", jid.String(), "error", err)
+		} else {
+			profile.Business = business
+		}
+	}
+
+	return profile, nil
+}
+
+// getBusinessProfile sends the query of whatsmeow's GetBusinessProfile, which
+// leaves out the description and websites and panics on profiles missing a
+// field.
+func (k *Controller) getBusinessProfile(jid types.JID) (*dto.BusinessProfile, error) {
+	resp, err := k.client.DangerousInternals().SendIQ(whatsmeow.DangerousInfoQuery{
+		Namespace: "w:biz",
+		Type:      "get",
+		To:        types.ServerJID,
+		Content: []waBinary.Node{{
+			Tag:   "business_profile",
+			Attrs: waBinary.Attrs{"v": "244"},
+			Content: []waBinary.Node{{
+				Tag:   "profile",
+				Attrs: waBinary.Attrs{"jid": jid},
+			}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	node, ok := resp.GetOptionalChildByTag("business_profile", "profile")
+	if !ok {
+		return nil, errors.New("business profile missing in response")
+	}
+
+	return businessProfile(&node), nil
+}
+
+// businessProfile reads the profile node of a business profile query.
+func businessProfile(node *waBinary.Node) *dto.BusinessProfile {
+	result := &dto.BusinessProfile{
+		Address:     nodeText(node.GetChildByTag("address")),
+		Email:       nodeText(node.GetChildByTag("email")),
+		Description: nodeText(node.GetChildByTag("description")),
+		Websites:    []string{},
+		Categories:  []string{},
+		Options:     map[string]string{},
+		Hours:       []dto.BusinessHours{},
+	}
+
+	for _, website := range node.GetChildrenByTag("website") {
+		if url := nodeText(website); url != "" {
+			result.Websites = append(result.Websites, url)
+		}
+	}
+
+	categories := node.GetChildByTag("categories")
+	for _, category := range categories.GetChildrenByTag("category") {
+		result.Categories = append(result.Categories, nodeText(category))
+	}
+
+	options := node.GetChildByTag("profile_options")
+	for _, option := range options.GetChildren() {
+		result.Options[option.Tag] = nodeText(option)
+	}
+
+	hours := node.GetChildByTag("business_hours")
+	result.HoursTimeZone = hours.AttrGetter().OptionalString("timezone")
+	for _, config := range hours.GetChildrenByTag("business_hours_config") {
+		attrs := config.AttrGetter()
+		result.Hours = append(result.Hours, dto.BusinessHours{
+			DayOfWeek: attrs.OptionalString("dow"),
+			Mode:      attrs.OptionalString("mode"),
+			OpenTime:  attrs.OptionalString("open_time"),
+			CloseTime: attrs.OptionalString("close_time"),
+		})
+	}
+
+	return result
+}
+
+// nodeText is the text content of a node, empty when it has none.
+func nodeText(node waBinary.Node) string {
+	text, _ := node.Content.([]byte)
+	return string(text)
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hiddensetup/w/app/dto"
+	waBinary "go.mau.fi/whatsmeow/binary"
+)
+
+func TestBusinessProfile(t *testing.T) {
+	text := func(tag, content string) waBinary.Node {
+		return waBinary.Node{Tag: tag, Content: []byte(content)}
+	}
+
+	tests := []struct {
+		name string
+		node waBinary.Node
+		want *dto.BusinessProfile
+	}{
+		{"full", waBinary.Node{Tag: "profile", Content: []waBinary.Node{
+			text("address", "Main St 1"),
+			text("email", "shop@example.com"),
+			text("description", "We sell things"),
+			text("website", "https://example.com"),
+			text("website", "https://shop.example.com"),
+			{Tag: "categories", Content: []waBinary.Node{text("category", "Shopping & retail")}},
+			{Tag: "profile_options", Content: []waBinary.Node{text("commerce_experience", "catalog")}},
+			{Tag: "business_hours", Attrs: waBinary.Attrs{"timezone": "Europe/Madrid"}, Content: []waBinary.Node{
+				{Tag: "business_hours_config", Attrs: waBinary.Attrs{"dow": "mon", "mode": "specific_hours", "open_time": "540", "close_time": "1080"}},
+			}},
+		}}, &dto.BusinessProfile{
+			Address:       "Main St 1",
+			Email:         "shop@example.com",
+			Description:   "We sell things",
+			Websites:      []string{"https://example.com", "https://shop.example.com"},
+			Categories:    []string{"Shopping & retail"},
+			Options:       map[string]string{"commerce_experience": "catalog"},
+			HoursTimeZone: "Europe/Madrid",
+			Hours:         []dto.BusinessHours{{DayOfWeek: "mon", Mode: "specific_hours", OpenTime: "540", CloseTime: "1080"}},
+		}},
+		{"empty", waBinary.Node{Tag: "profile"}, &dto.BusinessProfile{
+			Websites:   []string{},
+			Categories: []string{},
+			Options:    map[string]string{},
+			Hours:      []dto.BusinessHours{},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := businessProfile(&tt.node); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("businessProfile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,36 +2,93 @@ package controllers
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"log/slog"
 	"os"
-	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/config"
 	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+	"github.com/hiddensetup/w/app/media"
+	"github.com/hiddensetup/w/app/rules"
+	"github.com/hiddensetup/w/app/store"
+	"github.com/hiddensetup/w/app/stream"
 	"github.com/skip2/go-qrcode"
 	"go.mau.fi/whatsmeow"
-	"go.mau.fi/whatsmeow/store"
+	waStore "go.mau.fi/whatsmeow/store"
 	"go.mau.fi/whatsmeow/store/sqlstore"
-	waLog "go.mau.fi/whatsmeow/util/log"
 )
 
 type Controller struct {
-	dbContainer *sqlstore.Container
-	client      *whatsmeow.Client
-	qrCode      string // Updated to instance variable
+	dbContainer  *sqlstore.Container
+	store        *store.Store
+	config       *config.Manager
+	client       *whatsmeow.Client
+	qrCode       string // Updated to instance variable
+	contacts     *contactCache
+	settings     *settings
+	rules        *rules.Engine
+	media        *media.Store
+	mediaRetries *mediaRetries
+	fetcher      atomic.Value // *media.Fetcher, replaced on reload
+	lifecycle    chan string
+	stream       *stream.Hub
+	history      historySync
+	// outbox tracks webhook deliveries in flight, so shutdown can wait for them.
+	outbox sync.WaitGroup
+	// connectedBefore is set once connected, to count reconnects.
+	connectedBefore int32
 }
 
-func NewController(db *sqlstore.Container) *Controller {
+func NewController(db *sqlstore.Container, appStore *store.Store, cfg *config.Manager) *Controller {
 	cntrl := &Controller{
-		dbContainer: db,
-		qrCode:      "", // Initialize qrCode
+		dbContainer:  db,
+		store:        appStore,
+		config:       cfg,
+		qrCode:       "", // Initialize qrCode
+		settings:     &settings{},
+		rules:        rules.NewEngine(),
+		mediaRetries: newMediaRetries(),
+		lifecycle:    make(chan string, 1),
+		stream:       stream.NewHub(),
+		history:      newHistorySync(),
 	}
 
-	clientLog := waLog.Stdout("Client", os.Getenv("LOG_LEVEL"), true)
+	cntrl.contacts = newContactCache(cntrl.contactCacheTTL)
+
+	clientLog := logging.WA("Client")
 	cntrl.client = whatsmeow.NewClient(cntrl.getDevice(), clientLog)
+	// Full syncs carry the labels and chat states, see handleLabel.
+	cntrl.client.EmitAppStateEventsOnFullSync = true
 	cntrl.client.AddEventHandler(cntrl.eventHandler)
 
+	mediaStore, err := newMediaStore(cfg.Get())
+	if err != nil {
+		slog.Error("Opening media store failed", "error", err)
+	}
+	cntrl.media = mediaStore
+
+	fetcher, err := newFetcher(cfg.Get())
+	if err != nil {
+		slog.Error("Invalid media fetcher configuration, using defaults", "error", err)
+		fetcher = media.NewFetcher(media.FetcherConfig{Timeout: 30 * time.Second, MaxSize: 100 << 20})
+	}
+	cntrl.fetcher.Store(fetcher)
+
+	if err := cntrl.loadSettings(); err != nil {
+		slog.Error("Loading settings failed", "error", err)
+	}
+	if err := cntrl.loadRules(); err != nil {
+		slog.Error("Loading rules failed", "error", err)
+	}
+
+	go cntrl.pruneEvents()
+	go cntrl.ingestHistoryChunks()
+	go cntrl.postHistory()
+
 	return cntrl
 }
 
@@ -40,7 +97,7 @@ func (k *Controller) Login(c *fiber.Ctx) error {
 		// No ID stored, new login
 		if !k.client.IsConnected() {
 			if err := k.client.Connect(); err != nil {
-				k.client.Log.Errorf("WhatsApp connection error: %s", err.Error())
+				logging.FromContext(c.UserContext()).Error("Connecting to WhatsApp failed", "error", err)
 				return c.SendStatus(500)
 			}
 		}
@@ -49,12 +106,12 @@ func (k *Controller) Login(c *fiber.Ctx) error {
 
 		qrChan, err := k.client.GetQRChannel(context.Background())
 		if err != nil {
-			k.client.Log.Errorf("WhatsApp connection error: %s", err.Error())
+			logging.FromContext(c.UserContext()).Error("Connecting to WhatsApp failed", "error", err)
 			return c.SendStatus(500)
 		}
 
 		if err := k.client.Connect(); err != nil {
-			k.client.Log.Errorf("WhatsApp connection error: %s", err.Error())
+			logging.FromContext(c.UserContext()).Error("Connecting to WhatsApp failed", "error", err)
 			return c.SendStatus(500)
 		}
 
@@ -65,7 +122,7 @@ func (k *Controller) Login(c *fiber.Ctx) error {
 				if k.qrCode != "" {
 					qrCodeImg, err := qrcode.Encode(k.qrCode, qrcode.Medium, 500)
 					if err != nil {
-						k.client.Log.Errorf("QR code generation error: %s", err.Error())
+						logging.FromContext(c.UserContext()).Error("Generating QR code failed", "error", err)
 						return c.SendStatus(500)
 					}
 
@@ -78,7 +135,7 @@ func (k *Controller) Login(c *fiber.Ctx) error {
 	} else {
 		// Already logged in, just connect
 		if err := k.Autologin(); err != nil {
-			k.client.Log.Errorf("WhatsApp connection error: %s", err.Error())
+			logging.FromContext(c.UserContext()).Error("Connecting to WhatsApp failed", "error", err)
 			return c.SendStatus(500)
 		}
 
@@ -93,7 +150,7 @@ func (k *Controller) Autologin() error {
 	if k.client.Store.ID != nil && !k.client.IsConnected() {
 		err := k.client.Connect()
 		if err != nil {
-			k.client.Log.Errorf("WhatsApp connection error: %s", err.Error())
+			slog.Error("Connecting to WhatsApp failed", "error", err)
 			return err
 		}
 	}
@@ -101,69 +158,43 @@ func (k *Controller) Autologin() error {
 	return nil
 }
 func (k *Controller) Logout(c *fiber.Ctx) error {
+	if err := k.LogoutSession(); err != nil {
+		return c.JSON(dto.Response{Status: false})
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
+
+// LogoutSession removes the WhatsApp session, for the Logout endpoint and the
+// logout command.
+func (k *Controller) LogoutSession() error {
 	// Remove the whatsappstore.db file if it exists
 	if _, err := os.Stat("whatsappstore.db"); err == nil {
-		fmt.Println("File whatsappstore.db exists. Attempting to delete...")
 		if err := os.Remove("whatsappstore.db"); err != nil {
-			// Handle the error more gracefully, log it, and continue
-			fmt.Printf("Error removing whatsappstore.db: %s\n", err)
-			return c.JSON(dto.Response{Status: false})
+			slog.Error("Removing whatsappstore.db failed", "error", err)
+			return err
 		}
-		fmt.Println("File whatsappstore.db successfully deleted.")
-	} else {
-		fmt.Println("File whatsappstore.db does not exist.")
+		slog.Info("Removed whatsappstore.db")
 	}
 
 	// Log out the user
 	if k.client != nil {
 		if err := k.client.Logout(); err != nil {
-			// Handle the error more gracefully, return an error response
-			fmt.Printf("Error logging out: %s\n", err)
-			return c.JSON(dto.Response{Status: false})
+			slog.Error("Logging out failed", "error", err)
+			return err
 		}
-		fmt.Println("User successfully logged out.")
+		slog.Info("Logged out")
 	}
 
-	return c.JSON(dto.Response{Status: true})
-}
-
-func (k *Controller) ExecuteScript(c *fiber.Ctx) error {
-	scriptPath := "./start.sh"
-
-	// Prepare to capture output and error
-	cmd := exec.Command("bash", scriptPath)
-	output, err := cmd.CombinedOutput()
-
-	if err != nil {
-		log.Printf("Error executing script: %s\nOutput: %s", err, string(output))
-		return c.JSON(dto.Response{Status: false})
-	}
-
-	log.Printf("Script output: %s", string(output))
-	return c.JSON(dto.Response{Status: true})
-}
-
-func (k *Controller) Off(c *fiber.Ctx) error {
-	scriptPath := "./stop.sh"
-
-	// Execute the script
-	cmd := exec.Command("bash", scriptPath)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return c.JSON(dto.Response{Status: false})
-	}
-
-	return c.JSON(dto.Response{Status: true})
+	return nil
 }
 
-func (k *Controller) getDevice() *store.Device {
+func (k *Controller) getDevice() *waStore.Device {
 	// If you want multiple sessions, remember their JIDs and use .GetDevice(jid) or .GetAllDevices() instead.
 	deviceStore, err := k.dbContainer.GetFirstDevice()
 
 	if err != nil {
-		k.client.Log.Errorf("Device getting error: %s", err.Error())
+		slog.Error("Getting device failed", "error", err)
 
 		return nil
 	}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/store"
+	"go.mau.fi/whatsmeow"
+)
+
+// errBadRequest marks errors caused by invalid input, see badRequest.
+var errBadRequest = errors.New("bad request")
+
+type badRequestError struct {
+	err error
+}
+
+func (e badRequestError) Error() string {
+	return e.err.Error()
+}
+
+func (e badRequestError) Is(target error) bool {
+	return target == errBadRequest
+}
+
+func (e badRequestError) Unwrap() error {
+	return e.err
+}
+
+// badRequest wraps err so errorStatus maps it to 400.
+func badRequest(err error) error {
+	return badRequestError{err: err}
+}
+
+// fail writes a failed dto.Response with the given HTTP status and error text.
+func fail(c *fiber.Ctx, status int, err error) error {
+	return c.Status(status).JSON(dto.Response{Status: false, Error: err.Error()})
+}
+
+// errorStatus maps whatsmeow errors to the closest HTTP status code.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, errBadRequest):
+		return fiber.StatusBadRequest
+	case errors.Is(err, store.ErrNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, whatsmeow.ErrNotLoggedIn),
+		errors.Is(err, whatsmeow.ErrNotConnected):
+		return fiber.StatusServiceUnavailable
+	case errors.Is(err, whatsmeow.ErrIQBadRequest),
+		errors.Is(err, whatsmeow.ErrInviteLinkInvalid):
+		return fiber.StatusBadRequest
+	case errors.Is(err, whatsmeow.ErrIQNotAuthorized),
+		errors.Is(err, whatsmeow.ErrIQForbidden),
+		errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized),
+		errors.Is(err, whatsmeow.ErrGroupInviteLinkUnauthorized),
+		errors.Is(err, whatsmeow.ErrNotInGroup):
+		return fiber.StatusForbidden
+	case errors.Is(err, whatsmeow.ErrIQNotFound),
+		errors.Is(err, whatsmeow.ErrProfilePictureNotSet),
+		errors.Is(err, whatsmeow.ErrGroupNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, whatsmeow.ErrInviteLinkRevoked):
+		return fiber.StatusGone
+	case errors.Is(err, whatsmeow.ErrIQTimedOut):
+		return fiber.StatusGatewayTimeout
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/metrics"
+	"github.com/hiddensetup/w/app/store"
+	"github.com/hiddensetup/w/app/stream"
+)
+
+const (
+	// streamHeartbeat keeps idle connections from being closed by proxies.
+	streamHeartbeat = 25 * time.Second
+	// eventPruneInterval is how often events past EVENT_RETENTION_HOURS are
+	// deleted.
+	eventPruneInterval = time.Hour
+	// replayPageSize is how many stored events are read at a time on resume.
+	replayPageSize = 500
+)
+
+// errStreamClosed ends a stream whose subscription was dropped, because the
+// client fell behind or the gateway is shutting down.
+var errStreamClosed = errors.New("event stream closed")
+
+// publish stores an event and hands it to the stream clients. It is called
+// next to the webhook deliveries, so clients get the same events.
+func (k *Controller) publish(eventType, chat string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Encoding stream event failed", "type", eventType, "error", err)
+		return
+	}
+
+	event, err := k.store.AppendEvent(eventType, chat, data)
+	if err != nil {
+		slog.Error("Storing stream event failed", "type", eventType, "error", err)
+		return
+	}
+
+	k.stream.Publish(event)
+}
+
+// publishEvent publishes one of the event DTOs proxied to PROXY_URL, under
+// the name in its Event field.
+func (k *Controller) publishEvent(event interface{}) {
+	switch v := event.(type) {
+	case dto.PresenceEvent:
+		chat := v.Chat
+		if chat == "" {
+			chat = v.JID
+		}
+		k.publish(v.Event, chat, v)
+	case dto.ContactEvent:
+		k.publish(v.Event, v.JID, v)
+	case dto.ChatEvent:
+		k.publish(v.Event, v.JID, v)
+	case dto.LabelEvent:
+		k.publish(v.Event, v.JID, v)
+	case dto.StatusUpdate:
+		k.publish(v.Event, v.Sender, v)
+	}
+}
+
+// CloseStreams ends the event streams, otherwise their connections would hold
+// up the server shutdown.
+func (k *Controller) CloseStreams() {
+	k.stream.Close()
+}
+
+// pruneEvents deletes events past EVENT_RETENTION_HOURS, for good.
+func (k *Controller) pruneEvents() {
+	ticker := time.NewTicker(eventPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		retention := time.Duration(k.config.Get().EventRetentionHours) * time.Hour
+		if n, err := k.store.PruneEvents(time.Now().Add(-retention)); err != nil {
+			slog.Error("Pruning stream events failed", "error", err)
+		} else if n > 0 {
+			slog.Debug("Pruned stream events", "count", n)
+		}
+
+		<-ticker.C
+	}
+}
+
+// streamParams reads the filters and the ID to resume after. lastEventID is
+// the SSE Last-Event-ID header, which wins over the since query parameter.
+// afterID is -1 when the client doesn't resume.
+func streamParams(c *fiber.Ctx, lastEventID string) (filter stream.Filter, afterID int64, err error) {
+	filter, err = stream.ParseFilter(c.Query(`types`), c.Query(`chats`))
+	if err != nil {
+		return filter, 0, fmt.Errorf("invalid chats pattern: %w", err)
+	}
+
+	since := c.Query(`since`)
+	if lastEventID != "" {
+		since = lastEventID
+	}
+	if since == "" {
+		return filter, -1, nil
+	}
+
+	afterID, err = strconv.ParseInt(since, 10, 64)
+	if err != nil || afterID < 0 {
+		return filter, 0, errors.New("since must be an event ID")
+	}
+
+	return filter, afterID, nil
+}
+
+// streamEvents sends the stored events after afterID, if given, then the live
+// ones until send fails, done is closed or the subscription is dropped.
+// Subscribing before the replay makes sure no event falls in between.
+func (k *Controller) streamEvents(filter stream.Filter, afterID int64, send func(store.Event) error, ping func() error, done <-chan struct{}) error {
+	sub := k.stream.Subscribe(filter)
+	defer k.stream.Unsubscribe(sub)
+
+	metrics.StreamClients.Inc()
+	defer metrics.StreamClients.Dec()
+
+	last := afterID
+	for afterID >= 0 {
+		page, err := k.store.Events(last, replayPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range page {
+			last = event.ID
+			if !filter.Matches(event) {
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < replayPageSize {
+			break
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return errStreamClosed
+			}
+			if event.ID <= last {
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		case <-heartbeat.C:
+			if err := ping(); err != nil {
+				return err
+			}
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// EventsUpgrade checks the stream parameters before the connection is
+// upgraded to a WebSocket, so mistakes still get a JSON error.
+func (k *Controller) EventsUpgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fail(c, fiber.StatusUpgradeRequired, errors.New("websocket upgrade required, or use /api/events/sse"))
+	}
+
+	filter, afterID, err := streamParams(c, "")
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	c.Locals("streamFilter", filter)
+	c.Locals("streamAfter", afterID)
+
+	return c.Next()
+}
+
+// EventsWebSocket streams events as JSON text messages. Messages from the
+// client are ignored, reading them only notices when it goes away.
+func (k *Controller) EventsWebSocket(conn *websocket.Conn) {
+	filter, _ := conn.Locals("streamFilter").(stream.Filter)
+	afterID, _ := conn.Locals("streamAfter").(int64)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(event store.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteJSON(event)
+	}
+	ping := func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+	}
+
+	err := k.streamEvents(filter, afterID, send, ping, done)
+	if errors.Is(err, errStreamClosed) {
+		// The client reconnects and resumes from the last ID it got.
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "stream closed, resume with since"),
+			time.Now().Add(time.Second))
+	} else if err != nil {
+		slog.Debug("Event stream ended", "transport", "websocket", "error", err)
+	}
+	conn.Close()
+}
+
+// EventsSSE streams events as server-sent events, for clients that can't use
+// WebSockets. Browsers resume with the Last-Event-ID header by themselves.
+func (k *Controller) EventsSSE(c *fiber.Ctx) error {
+	filter, afterID, err := streamParams(c, c.Get(`Last-Event-ID`))
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		send := func(event store.Event) error {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+			return w.Flush()
+		}
+		ping := func() error {
+			w.WriteString(": ping\n\n")
+			return w.Flush()
+		}
+
+		// The client going away shows as a failed write.
+		if err := k.streamEvents(filter, afterID, send, ping, nil); err != nil && !errors.Is(err, errStreamClosed) {
+			slog.Debug("Event stream ended", "transport", "sse", "error", err)
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/store"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// ExportMessages writes the stored messages as JSON lines, for the export
+// command, and returns how many were written.
+func (k *Controller) ExportMessages(w io.Writer, chat string, since time.Time) (int, error) {
+	encoder := json.NewEncoder(w)
+	count := 0
+
+	err := k.store.Messages(chat, since, func(msg store.Message) error {
+		exported := dto.ExportedMessage{
+			ID:        msg.ID,
+			Chat:      msg.Chat,
+			Sender:    msg.Sender,
+			PushName:  msg.PushName,
+			IsFromMe:  msg.IsFromMe,
+			IsGroup:   msg.IsGroup,
+			Timestamp: msg.Timestamp.UTC().Format(time.RFC3339),
+			MediaType: msg.MediaType,
+		}
+
+		var content waProto.Message
+		if err := proto.Unmarshal(msg.Raw, &content); err == nil {
+			exported.Text = messageText(&content)
+		}
+
+		count++
+		return encoder.Encode(exported)
+	})
+
+	return count, err
+}
+
+// messageText returns the text of a message or the caption of its media.
+func messageText(msg *waProto.Message) string {
+	msg = unwrapMessage(msg)
+
+	switch {
+	case msg == nil:
+		return ""
+	case msg.GetConversation() != "":
+		return msg.GetConversation()
+	case msg.ExtendedTextMessage != nil:
+		return msg.ExtendedTextMessage.GetText()
+	case msg.ImageMessage != nil:
+		return msg.ImageMessage.GetCaption()
+	case msg.VideoMessage != nil:
+		return msg.VideoMessage.GetCaption()
+	case msg.DocumentMessage != nil:
+		return msg.DocumentMessage.GetCaption()
+	}
+
+	return ""
+}
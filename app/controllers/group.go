@@ -0,0 +1,334 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+	"github.com/hiddensetup/w/app/media"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+const maxGroupPhotoSize = 5 << 20
+
+var participantChanges = map[string]whatsmeow.ParticipantChange{
+	"add":     whatsmeow.ParticipantChangeAdd,
+	"remove":  whatsmeow.ParticipantChangeRemove,
+	"promote": whatsmeow.ParticipantChangePromote,
+	"demote":  whatsmeow.ParticipantChangeDemote,
+}
+
+func (k *Controller) Groups(c *fiber.Ctx) error {
+	groups, err := k.client.GetJoinedGroups()
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Listing joined groups failed", "error", err)
+		return fail(c, errorStatus(err), err)
+	}
+
+	result := make([]dto.Group, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, groupInfo(group))
+	}
+
+	return c.JSON(result)
+}
+
+func (k *Controller) GroupInfo(c *fiber.Ctx) error {
+	jid, err := groupJID(c)
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	group, err := k.client.GetGroupInfo(jid)
+	if err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(groupInfo(group))
+}
+
+func (k *Controller) GroupParticipants(c *fiber.Ctx) error {
+	jid, err := groupJID(c)
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	group, err := k.client.GetGroupInfo(jid)
+	if err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(groupParticipants(group.Participants))
+}
+
+func (k *Controller) CreateGroup(c *fiber.Ctx) error {
+	req := dto.CreateGroupRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return fail(c, fiber.StatusBadRequest, errors.New("group name is required"))
+	}
+
+	participants, err := parseJIDs(req.Participants)
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	group, err := k.client.CreateGroup(whatsmeow.ReqCreateGroup{
+		Name:         req.Name,
+		Participants: participants,
+	})
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Creating group failed", "error", err)
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(groupInfo(group))
+}
+
+// UpdateGroupParticipants adds, removes, promotes or demotes participants. The
+// per-participant result carries WhatsApp's error code, e.g. 403 when the
+// user's privacy settings don't allow being added.
+func (k *Controller) UpdateGroupParticipants(c *fiber.Ctx) error {
+	jid, err := groupJID(c)
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	action, ok := participantChanges[c.Params(`action`)]
+	if !ok {
+		return fail(c, fiber.StatusBadRequest, errors.New("action must be add, remove, promote or demote"))
+	}
+
+	req := dto.GroupParticipantsRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	participants, err := parseJIDs(req.Participants)
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+	if len(participants) == 0 {
+		return fail(c, fiber.StatusBadRequest, errors.New("no participants given"))
+	}
+
+	result, err := k.client.UpdateGroupParticipants(jid, participants, action)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Updating group participants failed", "error", err)
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(groupParticipants(result))
+}
+
+func (k *Controller) SetGroupSubject(c *fiber.Ctx) error {
+	jid, err := groupJID(c)
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	req := dto.GroupTextRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		return fail(c, fiber.StatusBadRequest, errors.New("subject is required"))
+	}
+
+	if err := k.client.SetGroupName(jid, req.Text); err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
+
+func (k *Controller) SetGroupDescription(c *fiber.Ctx) error {
+	jid, err := groupJID(c)
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	req := dto.GroupTextRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	// WhatsApp rejects the change unless the previous topic ID is given.
+	group, err := k.client.GetGroupInfo(jid)
+	if err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	if err := k.client.SetGroupTopic(jid, group.TopicID, "", req.Text); err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
+
+// SetGroupPhoto expects the image in the photo form field. WhatsApp only
+// accepts JPEG, so other formats are re-encoded first.
+func (k *Controller) SetGroupPhoto(c *fiber.Ctx) error {
+	jid, err := groupJID(c)
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	header, err := c.FormFile(`photo`)
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, errors.New("photo file is required"))
+	}
+	if header.Size > maxGroupPhotoSize {
+		return fail(c, fiber.StatusRequestEntityTooLarge, errors.New("photo is too large"))
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+	defer file.Close()
+
+	photo, err := io.ReadAll(file)
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	photo, err = media.ToJPEG(photo)
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	pictureID, err := k.client.SetGroupPhoto(jid, photo)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Setting group photo failed", "error", err)
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{"status": true, "pictureId": pictureID})
+}
+
+// GroupInviteLink returns the current invite link. Resetting it changes the
+// group, that is RevokeGroupInviteLink.
+func (k *Controller) GroupInviteLink(c *fiber.Ctx) error {
+	return k.groupInviteLink(c, false)
+}
+
+func (k *Controller) RevokeGroupInviteLink(c *fiber.Ctx) error {
+	return k.groupInviteLink(c, true)
+}
+
+func (k *Controller) groupInviteLink(c *fiber.Ctx, reset bool) error {
+	jid, err := groupJID(c)
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	link, err := k.client.GetGroupInviteLink(jid, reset)
+	if err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(dto.GroupInviteResponse{Link: link})
+}
+
+// JoinGroup accepts either the bare invite code or a full chat.whatsapp.com link.
+func (k *Controller) JoinGroup(c *fiber.Ctx) error {
+	req := dto.JoinGroupRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	code := strings.TrimPrefix(strings.TrimSpace(req.Code), whatsmeow.InviteLinkPrefix)
+	if code == "" {
+		return fail(c, fiber.StatusBadRequest, errors.New("invite code is required"))
+	}
+
+	jid, err := k.client.JoinGroupWithLink(code)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Joining group failed", "error", err)
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{"status": true, "jid": jid.String()})
+}
+
+func (k *Controller) LeaveGroup(c *fiber.Ctx) error {
+	jid, err := groupJID(c)
+	if err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	if err := k.client.LeaveGroup(jid); err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
+
+func groupJID(c *fiber.Ctx) (types.JID, error) {
+	return parseGroupJID(c.Params(`jid`))
+}
+
+// parseGroupJID accepts group JIDs with or without the @g.us server.
+func parseGroupJID(value string) (types.JID, error) {
+	if !strings.ContainsRune(value, '@') {
+		value += "@" + types.GroupServer
+	}
+
+	jid, err := types.ParseJID(value)
+	if err != nil || jid.Server != types.GroupServer {
+		return jid, errors.New("invalid group jid: " + value)
+	}
+
+	return jid, nil
+}
+
+func parseJIDs(list []string) ([]types.JID, error) {
+	jids := make([]types.JID, 0, len(list))
+	for _, item := range list {
+		jid, ok := parseJID(item)
+		if !ok {
+			return nil, errors.New("invalid jid: " + item)
+		}
+		jids = append(jids, jid)
+	}
+
+	return jids, nil
+}
+
+func groupInfo(group *types.GroupInfo) dto.Group {
+	return dto.Group{
+		JID:               group.JID.String(),
+		Name:              group.Name,
+		Topic:             group.Topic,
+		TopicID:           group.TopicID,
+		Owner:             group.OwnerJID.String(),
+		IsLocked:          group.IsLocked,
+		IsAnnounce:        group.IsAnnounce,
+		IsEphemeral:       group.IsEphemeral,
+		DisappearingTimer: group.DisappearingTimer,
+		Created:           group.GroupCreated.String(),
+		Participants:      groupParticipants(group.Participants),
+	}
+}
+
+func groupParticipants(participants []types.GroupParticipant) []dto.GroupParticipant {
+	result := make([]dto.GroupParticipant, 0, len(participants))
+	for _, participant := range participants {
+		result = append(result, dto.GroupParticipant{
+			JID:          participant.JID.String(),
+			DisplayName:  participant.DisplayName,
+			IsAdmin:      participant.IsAdmin,
+			IsSuperAdmin: participant.IsSuperAdmin,
+			Error:        participant.Error,
+		})
+	}
+
+	return result
+}
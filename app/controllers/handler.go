@@ -2,32 +2,48 @@ package controllers
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"hash/fnv"
 	"io"
 	"io/ioutil"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
-	"os"
+	neturl "net/url"
 	"reflect"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+	"github.com/hiddensetup/w/app/metrics"
+	"github.com/hiddensetup/w/app/rules"
 	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 )
 
 var messageList []events.Message
-var enableGroupHandling bool = true
 
 func (k *Controller) eventHandler(evt interface{}) {
+	k.trackConnection(evt)
+
 	switch v := evt.(type) {
 	case *events.Message:
+		metrics.MessagesReceived.WithLabelValues(messageType(v.Message)).Inc()
+		logger := slog.Default().With("message_id", v.Info.ID)
+
+		if v.Info.Chat == types.StatusBroadcastJID {
+			k.handleStatus(v)
+			return
+		}
+		if v.Info.IsGroup && !k.groupAllowed(v.Info.Chat) {
+			return
+		}
+
 		messageList = append(messageList, *v)
+		k.saveMessage(v)
 
 		caption := ""
 		if v.Message.ImageMessage != nil {
@@ -48,7 +64,7 @@ func (k *Controller) eventHandler(evt interface{}) {
 			Sender:       v.Info.Sender.String(),
 			SenderName:   v.Info.PushName,
 			IsFromMe:     v.Info.IsFromMe,
-			IsGroup:      v.Info.IsGroup && enableGroupHandling,
+			IsGroup:      v.Info.IsGroup,
 			IsEphemeral:  v.IsEphemeral,
 			IsViewOnce:   v.IsViewOnce,
 			Timestamp:    v.Info.Timestamp.String(),
@@ -57,6 +73,10 @@ func (k *Controller) eventHandler(evt interface{}) {
 			Conversation: v.Message.GetConversation(),
 		}
 
+		// Unless structured group handling is on, group messages carry the
+		// sender's name in the conversation text.
+		prefixSender := mess.IsGroup && !k.groupSettings().Structured
+
 		// Check if the message is forwarded
 		isForwarded := false
 		if v.Message.ExtendedTextMessage != nil &&
@@ -72,10 +92,27 @@ func (k *Controller) eventHandler(evt interface{}) {
 			}
 		}
 
+		routing := k.rules.Evaluate(rules.Message{
+			Chat:      mess.Chat,
+			Sender:    mess.Sender,
+			IsGroup:   mess.IsGroup,
+			IsFromMe:  mess.IsFromMe,
+			MediaType: mess.MediaType,
+			Text:      strings.TrimSpace(mess.Conversation + "\n" + caption),
+		})
+		if routing.Drop {
+			return
+		}
+		mess.Tags = strings.Join(routing.Tags, ",")
+		if !mess.IsFromMe {
+			for _, reply := range routing.Replies {
+				go k.autoReply(logging.NewContext(context.Background(), logger), v.Info.Chat, reply)
+			}
+		}
+
 		var attachment dto.MessageAttachment
 		if mess.MediaType != "" {
-			attachment.File, _ = k.client.DownloadAny(v.Message)
-			attachment.Filename = getFilename(v.Info.MediaType, v.Message)
+			attachment = k.loadAttachment(v.Message)
 		}
 
 		// Handle quoted messages
@@ -95,16 +132,13 @@ func (k *Controller) eventHandler(evt interface{}) {
 
 				attachmentHandlers := map[string]func(*waProto.Message){
 					"image": func(m *waProto.Message) {
-						attachment.File, _ = k.client.DownloadAny(m)
-						attachment.Filename = getFilename("image", m)
+						attachment = k.loadAttachment(m)
 					},
 					"video": func(m *waProto.Message) {
-						attachment.File, _ = k.client.DownloadAny(m)
-						attachment.Filename = getFilename("video", m)
+						attachment = k.loadAttachment(m)
 					},
 					"audio": func(m *waProto.Message) {
-						attachment.File, _ = k.client.DownloadAny(m)
-						attachment.Filename = getFilename("audio", m)
+						attachment = k.loadAttachment(m)
 					},
 					"location": func(m *waProto.Message) {
 						mapsUrl := "https://maps.google.com"
@@ -128,7 +162,7 @@ func (k *Controller) eventHandler(evt interface{}) {
 					attachmentHandlers["location"](quotedMsg)
 				}
 
-				if mess.IsGroup {
+				if prefixSender {
 					if mess.Conversation != "" {
 						mess.Conversation = fmt.Sprintf("%s\n[\"%s\"]\n%s", mess.SenderName, quotedContent, mess.Conversation)
 					} else {
@@ -143,7 +177,7 @@ func (k *Controller) eventHandler(evt interface{}) {
 		// Handle forwarded messages
 		if isForwarded {
 			forwardedPrefix := "→Forwarded←\n"
-			if mess.IsGroup {
+			if prefixSender {
 				if mess.Conversation != "" {
 					mess.Conversation = fmt.Sprintf("%s%s\n%s", forwardedPrefix, mess.SenderName, mess.Conversation)
 				} else if mess.Caption != "" {
@@ -204,7 +238,7 @@ func (k *Controller) eventHandler(evt interface{}) {
 			mess.Caption = locationUrl
 		}
 
-		if mess.IsGroup && enableGroupHandling {
+		if prefixSender {
 			if v.Message.ExtendedTextMessage != nil {
 				if v.Message.ExtendedTextMessage.ContextInfo == nil {
 					if mess.IsFromMe {
@@ -224,24 +258,138 @@ func (k *Controller) eventHandler(evt interface{}) {
 			}
 		}
 
-		if mess.Chat != "status@broadcast" {
-			k.proxyToChatApp(mess, attachment)
+		if attachment.MediaID != "" {
+			mess.MediaURL = k.mediaURL(attachment.MediaID)
 		}
 
-		// Print JSON representation of the message
-		messageJSON, err := json.MarshalIndent(v, "", "  ")
-		if err != nil {
-			k.client.Log.Errorf("Error marshalling message to JSON: %s", err)
-		} else {
-			fmt.Printf("Message JSON:\n%s\n", string(messageJSON))
+		k.publish("message", mess.Chat, mess)
+
+		delivered := false
+		if len(routing.Webhooks) == 0 {
+			_, err := k.proxyToChatApp(mess, attachment)
+			delivered = err == nil
+		}
+		for _, webhook := range routing.Webhooks {
+			if _, err := k.postToChatApp(webhook, mess, attachment); err == nil {
+				delivered = true
+			}
 		}
 
-		// Print formatted message content
-		fmt.Printf("Formatted Message:\n%s\n", mess.Conversation)
+		k.autoMarkRead(v, delivered)
+
+		logger.Debug("Message received", "chat", mess.Chat, "sender", mess.Sender, "type", messageType(v.Message),
+			"text", mess.Conversation, "delivered", delivered)
+	case *events.Archive, *events.Pin, *events.Mute, *events.MarkChatAsRead, *events.ClearChat, *events.DeleteChat:
+		if event, ok := chatEvent(v); ok {
+			k.proxyEvent(event)
+		}
+	case *events.Connected:
+		go k.syncLabels()
+	case *events.LabelEdit, *events.LabelAssociationChat, *events.LabelAssociationMessage:
+		if event, ok := k.handleLabel(v); ok {
+			k.proxyEvent(event)
+		}
+	case *events.HistorySync:
+		k.handleHistorySync(v)
+	case *events.MediaRetry:
+		k.mediaRetries.deliver(v)
+	case *events.Presence:
+		k.proxyEvent(presenceEvent(v))
+	case *events.ChatPresence:
+		k.proxyEvent(chatPresenceEvent(v))
+	case *events.PushName:
+		k.proxyEvent(dto.ContactEvent{
+			Event:     "push_name",
+			JID:       v.JID.String(),
+			OldName:   v.OldPushName,
+			NewName:   v.NewPushName,
+			Timestamp: eventTimestamp(v.Message),
+		})
+	case *events.BusinessName:
+		k.proxyEvent(dto.ContactEvent{
+			Event:     "business_name",
+			JID:       v.JID.String(),
+			OldName:   v.OldBusinessName,
+			NewName:   v.NewBusinessName,
+			Timestamp: eventTimestamp(v.Message),
+		})
+	case *events.Contact:
+		// Full app state syncs replay the whole address book.
+		if v.FromFullSync {
+			return
+		}
+		k.proxyEvent(dto.ContactEvent{
+			Event:     "contact",
+			JID:       v.JID.String(),
+			NewName:   v.Action.GetFullName(),
+			Timestamp: v.Timestamp.String(),
+		})
+	}
+}
+
+func eventTimestamp(info *types.MessageInfo) string {
+	if info == nil {
+		return time.Now().String()
 	}
+
+	return info.Timestamp.String()
+}
+
+func (k *Controller) proxyToChatApp(message dto.IncomingMessage, attachment ...dto.MessageAttachment) (string, error) {
+	return k.postToChatApp(k.config.Get().ProxyURL, message, attachment...)
 }
 
-func (k *Controller) proxyToChatApp(message dto.IncomingMessage, attachment ...dto.MessageAttachment) string {
+// proxyEvent forwards a non-message event to PROXY_URL. Every event DTO has an
+// Event field so the chat app can tell them apart from incoming messages.
+func (k *Controller) proxyEvent(event interface{}) (string, error) {
+	k.publishEvent(event)
+
+	return k.postToChatApp(k.config.Get().ProxyURL, event)
+}
+
+// postToChatApp posts the fields as multipart form to url and returns the
+// response body. Any status other than 200 is an error.
+func (k *Controller) postToChatApp(url string, fields interface{}, attachment ...dto.MessageAttachment) (string, error) {
+	k.outbox.Add(1)
+	metrics.WebhookQueueDepth.Inc()
+	defer func() {
+		metrics.WebhookQueueDepth.Dec()
+		k.outbox.Done()
+	}()
+
+	logger := slog.Default().With("webhook", webhookHost(url))
+	if message, ok := fields.(dto.IncomingMessage); ok {
+		logger = logger.With("message_id", message.ID, "chat", message.Chat)
+	} else {
+		logger = logger.With("payload", fmt.Sprintf("%T", fields))
+	}
+
+	started := time.Now()
+	content, err := k.deliverWebhook(url, fields, attachment...)
+	duration := time.Since(started)
+	metrics.WebhookDuration.Observe(duration.Seconds())
+	if err != nil {
+		metrics.WebhookFailures.Inc()
+		logger.Error("Webhook delivery failed", "duration", duration.Round(time.Millisecond), "error", err)
+	} else {
+		logger.Debug("Webhook delivered", "duration", duration.Round(time.Millisecond))
+	}
+
+	return content, err
+}
+
+// webhookHost is the host of a webhook URL for the logs, whose query might
+// hold credentials.
+func webhookHost(rawURL string) string {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return "invalid"
+	}
+
+	return u.Host
+}
+
+func (k *Controller) deliverWebhook(url string, fields interface{}, attachment ...dto.MessageAttachment) (string, error) {
 	client := &http.Client{Timeout: time.Second * 10}
 
 	// New multipart writer.
@@ -249,46 +397,46 @@ func (k *Controller) proxyToChatApp(message dto.IncomingMessage, attachment ...d
 	writer := multipart.NewWriter(body)
 
 	// Encode message fields.
-	if err := encodeFields(writer, message); err != nil {
-		k.client.Log.Errorf("Encoding message fields error: %s", err)
-		return ""
+	if err := encodeFields(writer, fields); err != nil {
+		return "", err
 	}
 
 	// Handle attachment if provided.
 	if len(attachment) > 0 && !attachment[0].IsEmpty() {
 		if err := addAttachment(writer, attachment[0]); err != nil {
-			k.client.Log.Errorf("Adding attachment error: %s", err)
-			return ""
+			return "", err
 		}
 	}
 
 	writer.Close()
 
 	// Create and send request.
-	req, err := http.NewRequest("POST", os.Getenv("PROXY_URL"), body)
+	req, err := http.NewRequest("POST", url, body)
 	if err != nil {
-		k.client.Log.Errorf("Creating request error: %s", err)
-		return ""
+		return "", err
 	}
 
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 	resp, err := client.Do(req)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		k.client.Log.Errorf("Request error or status not OK: %s, status: %d", err, resp.StatusCode)
-		return ""
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("webhook responded with status %d", resp.StatusCode)
 	}
 
 	content, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		k.client.Log.Errorf("Reading response body error: %s", err)
-		return ""
+		return "", err
 	}
 
-	return string(content)
+	return string(content), nil
 }
 
-func encodeFields(writer *multipart.Writer, message dto.IncomingMessage) error {
-	v := reflect.ValueOf(message)
+func encodeFields(writer *multipart.Writer, fields interface{}) error {
+	v := reflect.ValueOf(fields)
 	typeOfS := v.Type()
 
 	for i := 0; i < v.NumField(); i++ {
@@ -311,59 +459,3 @@ func addAttachment(writer *multipart.Writer, attachment dto.MessageAttachment) e
 	_, err = io.Copy(fw, bytes.NewReader(attachment.File))
 	return err
 }
-
-func getFilename(mediaType string, message *waProto.Message) string {
-	type fileExtractor func() string
-
-	// Map MIME types to file extensions
-	mimeToExt := map[string]string{
-		"image/jpeg": "jpg",
-		"image/png":  "png",
-		"image/gif":  "gif",
-		"video/mp4":  "mp4",
-		"audio/ogg":  "ogg",
-		"audio/mp3":  "mp3",
-	}
-
-	// File extractors for different media types
-	extractors := map[string]fileExtractor{
-		"sticker": func() string { return hash(message.StickerMessage.String()) + ".webp" },
-		"gif":     func() string { return hash(message.VideoMessage.String()) + ".mp4" },
-		"image": func() string {
-			mimeType := message.ImageMessage.GetMimetype()
-			ext, exists := mimeToExt[mimeType]
-			if !exists {
-				ext = "png" // default to jpg if MIME type is unknown
-			}
-			return hash(message.ImageMessage.String()) + "." + ext
-		},
-		"video": func() string { return hash(message.VideoMessage.String()) + ".mp4" },
-		"document": func() string {
-			if message.DocumentMessage != nil {
-				return message.DocumentMessage.GetFileName()
-			}
-			return ""
-		},
-		"vcard": func() string { return message.ContactMessage.GetDisplayName() + ".vcf" },
-		"ptt":   func() string { return hash(message.AudioMessage.String()) + ".ogg" },
-		"audio": func() string { return hash(message.AudioMessage.String()) + ".mp3" },
-		"product": func() string {
-			if message.ProductMessage != nil {
-				return message.ProductMessage.String() + ".jpg"
-			}
-			return ""
-		},
-	}
-
-	if extractor, exists := extractors[mediaType]; exists {
-		return extractor()
-	}
-
-	return ""
-}
-
-func hash(s string) string {
-	h := fnv.New32a()
-	h.Write([]byte(s))
-	return strconv.FormatUint(uint64(h.Sum32()), 10)
-}
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+)
+
+// Healthz reports that the process is up and serving.
+func (k *Controller) Healthz(c *fiber.Ctx) error {
+	return c.JSON(dto.Response{Status: true})
+}
+
+// Readyz reports whether the gateway can do its job: the gateway database
+// answers and WhatsApp is connected and logged in.
+func (k *Controller) Readyz(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := k.store.Ping(ctx); err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(dto.Response{Status: false, Error: "gateway database: " + err.Error()})
+	}
+	if !k.client.IsConnected() || !k.client.IsLoggedIn() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(dto.Response{Status: false, Error: "not connected to WhatsApp"})
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hiddensetup/w/app/dto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const (
+	// historyQueueSize is how many history sync chunks can wait for
+	// ingestion before the event handler blocks.
+	historyQueueSize = 32
+	// historyWebhookQueueSize is how many history messages can wait for
+	// HISTORY_PROXY_URL. Past that they are dropped, not waited for.
+	historyWebhookQueueSize = 5000
+)
+
+// historySync keeps the progress of the history sync for the session status.
+// chunks feeds the one ingesting goroutine, which keeps them in order, and
+// webhook the one posting to HISTORY_PROXY_URL, so a slow webhook doesn't
+// hold up the ingestion.
+type historySync struct {
+	chunks  chan *events.HistorySync
+	webhook chan dto.HistoryMessage
+	mu      sync.Mutex
+	status  *dto.HistorySyncStatus
+}
+
+func newHistorySync() historySync {
+	return historySync{
+		chunks:  make(chan *events.HistorySync, historyQueueSize),
+		webhook: make(chan dto.HistoryMessage, historyWebhookQueueSize),
+	}
+}
+
+func (h *historySync) get() *dto.HistorySyncStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.status == nil {
+		return nil
+	}
+	status := *h.status
+
+	return &status
+}
+
+func (h *historySync) update(fn func(status *dto.HistorySyncStatus)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.status == nil {
+		h.status = &dto.HistorySyncStatus{}
+	}
+	fn(h.status)
+}
+
+// handleHistorySync queues a history sync chunk for ingestHistoryChunks, as
+// one can hold thousands of messages and ingesting it in the event handler
+// would hold up live ones.
+func (k *Controller) handleHistorySync(v *events.HistorySync) {
+	k.history.chunks <- v
+}
+
+// ingestHistoryChunks ingests the queued history sync chunks one at a time.
+func (k *Controller) ingestHistoryChunks() {
+	for v := range k.history.chunks {
+		k.ingestHistory(v)
+	}
+}
+
+// postHistory posts the queued history messages to HISTORY_PROXY_URL.
+func (k *Controller) postHistory() {
+	for msg := range k.history.webhook {
+		if proxyURL := k.config.Get().HistoryProxyURL; proxyURL != "" {
+			k.postToChatApp(proxyURL, msg)
+		}
+	}
+}
+
+// queueHistory queues a history message for postHistory. When the webhook
+// falls that far behind the message is dropped, it can still be exported
+// from the message store.
+func (k *Controller) queueHistory(msg dto.HistoryMessage) bool {
+	select {
+	case k.history.webhook <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// ingestHistory stores the messages of a chunk, so they can be exported and
+// their media downloaded, and queues them for HISTORY_PROXY_URL when set. The
+// media itself isn't downloaded, nor are rules applied, since none of it is
+// new.
+func (k *Controller) ingestHistory(v *events.HistorySync) {
+	proxyURL := k.config.Get().HistoryProxyURL
+	logger := slog.Default().With("sync_type", v.Data.GetSyncType().String(), "chunk", v.Data.GetChunkOrder())
+
+	conversations, messages, failed, dropped := 0, 0, 0, 0
+	for _, conv := range v.Data.GetConversations() {
+		chat, err := types.ParseJID(conv.GetID())
+		if err != nil {
+			logger.Warn("Invalid chat in history sync", "chat", conv.GetID(), "error", err)
+			continue
+		}
+		if chat == types.StatusBroadcastJID || (chat.Server == types.GroupServer && !k.groupAllowed(chat)) {
+			continue
+		}
+		conversations++
+
+		for _, item := range conv.GetMessages() {
+			msg, err := k.client.ParseWebMessage(chat, item.GetMessage())
+			if err != nil {
+				failed++
+				logger.Debug("Parsing history message failed", "chat", chat.String(), "error", err)
+				continue
+			}
+			if msg.Message == nil {
+				continue
+			}
+
+			k.saveMessage(msg)
+			messages++
+
+			if proxyURL != "" && !k.queueHistory(historyMessage(msg)) {
+				dropped++
+			}
+		}
+	}
+
+	k.history.update(func(status *dto.HistorySyncStatus) {
+		status.SyncType = v.Data.GetSyncType().String()
+		if progress := v.Data.GetProgress(); progress > status.Progress {
+			status.Progress = progress
+		}
+		status.Chunks++
+		status.Conversations += conversations
+		status.Messages += messages
+		status.Failed += failed
+		status.WebhookDropped += dropped
+		status.LastChunk = time.Now().Format(time.RFC3339)
+	})
+
+	logger.Info("History sync chunk stored", "conversations", conversations, "messages", messages,
+		"failed", failed, "webhook_dropped", dropped, "progress", v.Data.GetProgress())
+}
+
+func historyMessage(v *events.Message) dto.HistoryMessage {
+	return dto.HistoryMessage{
+		ID:           v.Info.ID,
+		Chat:         v.Info.Chat.String(),
+		Sender:       v.Info.Sender.String(),
+		SenderName:   v.Info.PushName,
+		IsFromMe:     v.Info.IsFromMe,
+		IsGroup:      v.Info.IsGroup,
+		Timestamp:    v.Info.Timestamp.String(),
+		MediaType:    v.Info.MediaType,
+		Conversation: messageText(v.Message),
+		Historical:   true,
+	}
+}
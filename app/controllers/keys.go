@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+	"github.com/hiddensetup/w/app/store"
+)
+
+func (k *Controller) APIKeys(c *fiber.Ctx) error {
+	keys, err := k.store.APIKeys()
+	if err != nil {
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+
+	return c.JSON(keys)
+}
+
+// CreateAPIKey generates a key. The secret is only returned here, the store
+// keeps its hash.
+func (k *Controller) CreateAPIKey(c *fiber.Ctx) error {
+	req := dto.CreateAPIKeyRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return fail(c, fiber.StatusBadRequest, errors.New("name is required"))
+	}
+	if len(req.Scopes) == 0 {
+		return fail(c, fiber.StatusBadRequest, errors.New("at least one scope is required"))
+	}
+	for _, scope := range req.Scopes {
+		if !validScope(scope) {
+			return fail(c, fiber.StatusBadRequest, errors.New("unknown scope: "+scope))
+		}
+	}
+
+	sessions := make([]string, 0, len(req.Sessions))
+	for _, session := range req.Sessions {
+		jid, ok := parseJID(session)
+		if !ok {
+			return fail(c, fiber.StatusBadRequest, errors.New("invalid session: "+session))
+		}
+		sessions = append(sessions, jid.User)
+	}
+
+	id, secret, err := generateAPIKey()
+	if err != nil {
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+
+	key := store.APIKey{
+		ID:       id,
+		Name:     req.Name,
+		Scopes:   req.Scopes,
+		Sessions: sessions,
+		Created:  time.Now(),
+	}
+	if err := k.store.CreateAPIKey(key, secret); err != nil {
+		logging.FromContext(c.UserContext()).Error("Creating API key failed", "error", err)
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(dto.CreateAPIKeyResponse{APIKey: key, Secret: secret})
+}
+
+func (k *Controller) DeleteAPIKey(c *fiber.Ctx) error {
+	if err := k.store.DeleteAPIKey(c.Params(`id`)); err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
+
+// SessionUser returns the phone number of the logged in account, or "" when
+// not logged in.
+func (k *Controller) SessionUser() string {
+	if k.client.Store.ID == nil {
+		return ""
+	}
+
+	return k.client.Store.ID.User
+}
+
+func validScope(scope string) bool {
+	for _, s := range store.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// generateAPIKey returns a random key ID and a secret that embeds it, so keys
+// can be recognized in logs by their ID without revealing the secret.
+func generateAPIKey() (string, string, error) {
+	idBytes := make([]byte, 6)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", err
+	}
+
+	id := hex.EncodeToString(idBytes)
+	return id, "wak_" + id + "_" + base64.RawURLEncoding.EncodeToString(secretBytes), nil
+}
@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+	"github.com/hiddensetup/w/app/store"
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Labels lists the WhatsApp Business labels with the chats tagged with them.
+// They are synced from the phone, which is where labels are created.
+func (k *Controller) Labels(c *fiber.Ctx) error {
+	labels, err := k.store.Labels()
+	if err != nil {
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+
+	return c.JSON(labels)
+}
+
+// ChatLabels lists the IDs of the labels on the :jid chat.
+func (k *Controller) ChatLabels(c *fiber.Ctx) error {
+	chat, ok := parseJID(c.Params(`jid`))
+	if !ok {
+		return fail(c, fiber.StatusBadRequest, errors.New("invalid jid"))
+	}
+
+	ids, err := k.store.ChatLabels(chat.String())
+	if err != nil {
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+
+	return c.JSON(ids)
+}
+
+func (k *Controller) LabelChat(c *fiber.Ctx) error {
+	return k.labelChat(c, true)
+}
+
+func (k *Controller) UnlabelChat(c *fiber.Ctx) error {
+	return k.labelChat(c, false)
+}
+
+func (k *Controller) labelChat(c *fiber.Ctx, labeled bool) error {
+	chat, ok := parseJID(c.Params(`jid`))
+	if !ok {
+		return fail(c, fiber.StatusBadRequest, errors.New("invalid jid"))
+	}
+	labelID := c.Params(`label`)
+	if err := k.checkLabel(labelID); err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	if err := k.client.SendAppState(appstate.BuildLabelChat(chat, labelID, labeled)); err != nil {
+		logging.FromContext(c.UserContext()).Error("Labeling chat failed", "chat", chat.String(), "error", err)
+		return fail(c, errorStatus(err), err)
+	}
+
+	// The phone doesn't send our own change back.
+	if err := k.store.LabelChat(labelID, chat.String(), labeled); err != nil {
+		logging.FromContext(c.UserContext()).Error("Saving chat label failed", "chat", chat.String(), "error", err)
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
+
+func (k *Controller) LabelMessage(c *fiber.Ctx) error {
+	return k.labelMessage(c, true)
+}
+
+func (k *Controller) UnlabelMessage(c *fiber.Ctx) error {
+	return k.labelMessage(c, false)
+}
+
+// labelMessage tags the :id message, looked up in the message store. Message
+// IDs are only unique per chat, the chat query parameter picks one.
+func (k *Controller) labelMessage(c *fiber.Ctx, labeled bool) error {
+	msg, err := k.store.Message(c.Params(`id`), c.Query(`chat`))
+	if err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+	chat, ok := parseJID(msg.Chat)
+	if !ok {
+		return fail(c, fiber.StatusInternalServerError, errors.New("invalid stored chat jid"))
+	}
+	labelID := c.Params(`label`)
+	if err := k.checkLabel(labelID); err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	if err := k.client.SendAppState(appstate.BuildLabelMessage(chat, labelID, msg.ID, labeled)); err != nil {
+		logging.FromContext(c.UserContext()).Error("Labeling message failed", "message_id", msg.ID, "error", err)
+		return fail(c, errorStatus(err), err)
+	}
+
+	if err := k.store.LabelMessage(labelID, msg.Chat, msg.ID, labeled); err != nil {
+		logging.FromContext(c.UserContext()).Error("Saving message label failed", "message_id", msg.ID, "error", err)
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
+
+// labelsSyncedKey is the setting holding the account whose labels were
+// fetched with a full app state sync.
+const labelsSyncedKey = "labels_synced"
+
+// syncLabels fetches the labels with a full app state sync once per account.
+// Sessions paired before labels were stored never get another full sync, and
+// a new pairing replaces the labels of the previous account. The events of the
+// sync fill the label store through handleLabel.
+func (k *Controller) syncLabels() {
+	if k.client.Store.ID == nil {
+		return
+	}
+	account := k.client.Store.ID.User
+
+	var synced string
+	if _, err := k.store.GetSetting(labelsSyncedKey, &synced); err != nil {
+		slog.Error("Reading label sync state failed", "error", err)
+		return
+	}
+	if synced == account {
+		return
+	}
+
+	if err := k.store.ClearLabels(); err != nil {
+		slog.Error("Clearing labels failed", "error", err)
+		return
+	}
+	if err := k.client.FetchAppState(appstate.WAPatchRegular, true, false); err != nil {
+		slog.Error("Fetching labels failed", "error", err)
+		return
+	}
+	if err := k.store.PutSetting(labelsSyncedKey, account); err != nil {
+		slog.Error("Saving label sync state failed", "error", err)
+	}
+}
+
+// checkLabel makes sure the label exists, WhatsApp accepts tags with unknown
+// labels, which then show nowhere.
+func (k *Controller) checkLabel(id string) error {
+	exists, err := k.store.LabelExists(id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+// handleLabel keeps the label store in sync with the phone and returns the
+// webhook event. Changes replayed by a full app state sync are stored but not
+// forwarded.
+func (k *Controller) handleLabel(evt interface{}) (dto.LabelEvent, bool) {
+	switch v := evt.(type) {
+	case *events.LabelEdit:
+		var err error
+		if v.Action.GetDeleted() {
+			err = k.store.DeleteLabel(v.LabelID)
+		} else {
+			err = k.store.SaveLabel(store.Label{
+				ID:           v.LabelID,
+				Name:         v.Action.GetName(),
+				Color:        v.Action.GetColor(),
+				PredefinedID: v.Action.GetPredefinedID(),
+			})
+		}
+		if err != nil {
+			slog.Error("Saving label failed", "label_id", v.LabelID, "error", err)
+		}
+
+		return dto.LabelEvent{
+			Event:     "label_edit",
+			LabelID:   v.LabelID,
+			Name:      v.Action.GetName(),
+			Color:     v.Action.GetColor(),
+			Deleted:   v.Action.GetDeleted(),
+			Timestamp: v.Timestamp.String(),
+		}, !v.FromFullSync
+	case *events.LabelAssociationChat:
+		if err := k.store.LabelChat(v.LabelID, v.JID.String(), v.Action.GetLabeled()); err != nil {
+			slog.Error("Saving chat label failed", "chat", v.JID.String(), "error", err)
+		}
+
+		return dto.LabelEvent{
+			Event:     "label_chat",
+			LabelID:   v.LabelID,
+			JID:       v.JID.String(),
+			Labeled:   v.Action.GetLabeled(),
+			Timestamp: v.Timestamp.String(),
+		}, !v.FromFullSync
+	case *events.LabelAssociationMessage:
+		if err := k.store.LabelMessage(v.LabelID, v.JID.String(), v.MessageID, v.Action.GetLabeled()); err != nil {
+			slog.Error("Saving message label failed", "message_id", v.MessageID, "error", err)
+		}
+
+		return dto.LabelEvent{
+			Event:     "label_message",
+			LabelID:   v.LabelID,
+			JID:       v.JID.String(),
+			MessageID: v.MessageID,
+			Labeled:   v.Action.GetLabeled(),
+			Timestamp: v.Timestamp.String(),
+		}, !v.FromFullSync
+	}
+
+	return dto.LabelEvent{}, false
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+)
+
+// Lifecycle actions requested through the admin endpoints, carried out by
+// main once the response has been sent.
+const (
+	ActionShutdown = "shutdown"
+	ActionRestart  = "restart"
+)
+
+var errLifecyclePending = errors.New("a shutdown or restart is already pending")
+
+// Lifecycle returns the channel admin requests to shut down or restart the
+// process are delivered on.
+func (k *Controller) Lifecycle() <-chan string {
+	return k.lifecycle
+}
+
+func (k *Controller) Shutdown(c *fiber.Ctx) error {
+	return k.requestLifecycle(c, ActionShutdown)
+}
+
+// Restart shuts down gracefully and starts the same binary again in place of
+// the current process, keeping its PID.
+func (k *Controller) Restart(c *fiber.Ctx) error {
+	return k.requestLifecycle(c, ActionRestart)
+}
+
+func (k *Controller) requestLifecycle(c *fiber.Ctx, action string) error {
+	select {
+	case k.lifecycle <- action:
+	default:
+		return fail(c, fiber.StatusConflict, errLifecyclePending)
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
+
+// Reload applies the configuration files and re-reads settings and rules from
+// the store, without restarting the process or dropping the WhatsApp
+// connection. An invalid configuration is rejected and the active one kept.
+func (k *Controller) Reload(c *fiber.Ctx) error {
+	restart, err := k.ReloadConfig()
+	if err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{"status": true, "restartRequired": restart})
+}
+
+// ReloadConfig is Reload for SIGHUP. It returns the changed settings that
+// only take effect on restart.
+func (k *Controller) ReloadConfig() ([]string, error) {
+	old, cfg, err := k.config.Reload()
+	if err != nil {
+		return nil, badRequest(err)
+	}
+
+	logging.Configure(cfg.LogLevel, cfg.LogRedact)
+
+	fetcher, err := newFetcher(cfg)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	k.fetcher.Store(fetcher)
+
+	if err := k.loadSettings(); err != nil {
+		return nil, err
+	}
+	if err := k.loadRules(); err != nil {
+		return nil, err
+	}
+
+	restart := cfg.RestartRequired(old)
+	for _, key := range restart {
+		slog.Warn("Configuration changed that only applies on restart", "setting", key)
+	}
+
+	return restart, nil
+}
+
+// Close disconnects from WhatsApp, so no new events arrive, then waits for
+// webhook deliveries in flight until ctx is done.
+func (k *Controller) Close(ctx context.Context) error {
+	k.client.Disconnect()
+
+	done := make(chan struct{})
+	go func() {
+		k.outbox.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		slog.Warn("Shutdown gave up waiting for webhook deliveries", "error", ctx.Err())
+		return ctx.Err()
+	}
+}
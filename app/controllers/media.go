@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/hiddensetup/w/app/config"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/media"
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+)
+
+// newMediaStore opens the attachment store in MEDIA_PATH, limited to
+// MEDIA_QUOTA_MB megabytes. Without MEDIA_PATH attachments aren't stored.
+func newMediaStore(cfg *config.Config) (*media.Store, error) {
+	if cfg.MediaPath == "" {
+		return nil, nil
+	}
+
+	return media.NewStore(cfg.MediaPath, cfg.MediaQuotaMB<<20)
+}
+
+// newFetcher configures the fetcher for outgoing media URLs from the
+// MEDIA_FETCH_* settings.
+func newFetcher(cfg *config.Config) (*media.Fetcher, error) {
+	headers, err := cfg.FetchHeaders()
+	if err != nil {
+		return nil, err
+	}
+
+	return media.NewFetcher(media.FetcherConfig{
+		Timeout:      time.Duration(cfg.MediaFetchTimeout) * time.Second,
+		MaxSize:      cfg.MediaFetchMaxMB << 20,
+		AllowHosts:   cfg.MediaFetchAllowHosts,
+		DenyHosts:    cfg.MediaFetchDenyHosts,
+		AllowPrivate: cfg.MediaFetchAllowPrivate,
+		Headers:      headers,
+	}), nil
+}
+
+// mediaFetcher returns the fetcher for the active configuration.
+func (k *Controller) mediaFetcher() *media.Fetcher {
+	return k.fetcher.Load().(*media.Fetcher)
+}
+
+// mediaURLMode reports whether webhooks get a download URL instead of the file.
+func (k *Controller) mediaURLMode() bool {
+	return k.media != nil && k.config.Get().MediaWebhookMode == "url"
+}
+
+func (k *Controller) mediaURL(id string) string {
+	cfg := k.config.Get()
+	base := strings.TrimRight(cfg.MediaBaseURL, "/")
+	if base == "" {
+		base = "http://localhost:" + cfg.Port
+	}
+
+	return base + "/api/media/" + id
+}
+
+// unwrapMessage returns the content of view-once, ephemeral and captioned
+// document wrappers. Received messages are already unwrapped by whatsmeow,
+// quoted ones aren't.
+func unwrapMessage(msg *waProto.Message) *waProto.Message {
+	for msg != nil {
+		switch {
+		case msg.ViewOnceMessage != nil:
+			msg = msg.ViewOnceMessage.Message
+		case msg.ViewOnceMessageV2 != nil:
+			msg = msg.ViewOnceMessageV2.Message
+		case msg.ViewOnceMessageV2Extension != nil:
+			msg = msg.ViewOnceMessageV2Extension.Message
+		case msg.EphemeralMessage != nil:
+			msg = msg.EphemeralMessage.Message
+		case msg.DocumentWithCaptionMessage != nil:
+			msg = msg.DocumentWithCaptionMessage.Message
+		default:
+			return msg
+		}
+	}
+
+	return nil
+}
+
+// downloadable returns the media part of a message.
+func downloadable(msg *waProto.Message) whatsmeow.DownloadableMessage {
+	msg = unwrapMessage(msg)
+
+	switch {
+	case msg == nil:
+		return nil
+	case msg.ImageMessage != nil:
+		return msg.ImageMessage
+	case msg.VideoMessage != nil:
+		return msg.VideoMessage
+	case msg.PtvMessage != nil:
+		return msg.PtvMessage
+	case msg.AudioMessage != nil:
+		return msg.AudioMessage
+	case msg.DocumentMessage != nil:
+		return msg.DocumentMessage
+	case msg.StickerMessage != nil:
+		return msg.StickerMessage
+	case msg.ProductMessage.GetProduct().GetProductImage() != nil:
+		return msg.ProductMessage.GetProduct().GetProductImage()
+	default:
+		return nil
+	}
+}
+
+// attachmentFilename names the attachment of a message from its own MIME type
+// and content hash, see media.Filename.
+func attachmentFilename(msg *waProto.Message) string {
+	msg = unwrapMessage(msg)
+
+	switch {
+	case msg == nil:
+		return ""
+	case msg.ImageMessage != nil:
+		return media.Filename(media.FileInfo{Kind: media.NameImage, MimeType: msg.ImageMessage.GetMimetype(), SHA256: msg.ImageMessage.GetFileSHA256()})
+	case msg.VideoMessage != nil:
+		kind := media.NameVideo
+		if msg.VideoMessage.GetGifPlayback() {
+			kind = media.NameGIF
+		}
+		return media.Filename(media.FileInfo{Kind: kind, MimeType: msg.VideoMessage.GetMimetype(), SHA256: msg.VideoMessage.GetFileSHA256()})
+	case msg.PtvMessage != nil:
+		return media.Filename(media.FileInfo{Kind: media.NamePTV, MimeType: msg.PtvMessage.GetMimetype(), SHA256: msg.PtvMessage.GetFileSHA256()})
+	case msg.AudioMessage != nil:
+		kind := media.NameAudio
+		if msg.AudioMessage.GetPTT() {
+			kind = media.NamePTT
+		}
+		return media.Filename(media.FileInfo{Kind: kind, MimeType: msg.AudioMessage.GetMimetype(), SHA256: msg.AudioMessage.GetFileSHA256()})
+	case msg.StickerMessage != nil:
+		return media.Filename(media.FileInfo{Kind: media.NameSticker, MimeType: msg.StickerMessage.GetMimetype(), SHA256: msg.StickerMessage.GetFileSHA256()})
+	case msg.DocumentMessage != nil:
+		return media.Filename(media.FileInfo{
+			Kind:     media.NameDocument,
+			MimeType: msg.DocumentMessage.GetMimetype(),
+			Name:     msg.DocumentMessage.GetFileName(),
+			SHA256:   msg.DocumentMessage.GetFileSHA256(),
+		})
+	case msg.ContactMessage != nil:
+		return media.Filename(media.FileInfo{Kind: media.NameVCard, MimeType: "text/vcard", Name: msg.ContactMessage.GetDisplayName()})
+	case msg.ProductMessage.GetProduct().GetProductImage() != nil:
+		image := msg.ProductMessage.GetProduct().GetProductImage()
+		return media.Filename(media.FileInfo{Kind: media.NameProduct, MimeType: image.GetMimetype(), SHA256: image.GetFileSHA256()})
+	default:
+		return ""
+	}
+}
+
+// loadAttachment gets the message's media, from the media store when it was
+// received before and from WhatsApp otherwise. In URL mode only the media ID
+// is filled in, the webhook gets a link instead of the file.
+func (k *Controller) loadAttachment(msg *waProto.Message) dto.MessageAttachment {
+	attachment := dto.MessageAttachment{Filename: attachmentFilename(msg)}
+
+	file := downloadable(msg)
+	if file == nil {
+		return attachment
+	}
+
+	if k.media != nil {
+		if id := media.ID(file.GetFileSHA256()); k.media.Has(id) {
+			attachment.MediaID = id
+			if !k.mediaURLMode() {
+				data, err := k.media.Read(id)
+				if err != nil {
+					slog.Error("Reading stored media failed", "media_id", id, "error", err)
+				}
+				attachment.File = data
+			}
+			return attachment
+		}
+	}
+
+	data, err := k.download(file)
+	if err != nil {
+		slog.Error("Downloading media failed", "error", err)
+		return attachment
+	}
+
+	if k.media != nil {
+		id, err := k.media.Save(data)
+		if err != nil {
+			slog.Error("Storing media failed", "error", err)
+		}
+		attachment.MediaID = id
+	}
+
+	if !k.mediaURLMode() || attachment.MediaID == "" {
+		attachment.File = data
+	}
+
+	return attachment
+}
+
+// Media serves a stored attachment, with range request support.
+func (k *Controller) Media(c *fiber.Ctx) error {
+	if k.media == nil {
+		return fail(c, fiber.StatusNotFound, errors.New("media store is disabled"))
+	}
+
+	id := c.Params(`id`)
+	file, err := k.media.Open(id)
+	if errors.Is(err, media.ErrInvalidID) {
+		return fail(c, fiber.StatusBadRequest, err)
+	} else if os.IsNotExist(err) {
+		return fail(c, fiber.StatusNotFound, errors.New("media not found"))
+	} else if err != nil {
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+
+	mtype, err := mimetype.DetectReader(file)
+	if err != nil {
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+
+	return adaptor.HTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Media comes from any contact, never let browsers render it on the
+		// gateway's origin.
+		w.Header().Set("Content-Type", mtype.String())
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Disposition", attachmentDisposition(id, mtype.String()))
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+		w.Header().Set("ETag", `"`+id+`"`)
+		http.ServeContent(w, r, id, info.ModTime(), file)
+	})(c)
+}
+
+// attachmentDisposition makes browsers download the file instead of showing it.
+func attachmentDisposition(name, mimeType string) string {
+	if ext := media.Extension(mimeType); ext != "" {
+		name += "." + ext
+	}
+
+	return "attachment; filename=" + strconv.Quote(name)
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"testing"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAttachmentFilename(t *testing.T) {
+	hash := []byte{0xca, 0xfe}
+	image := &waProto.ImageMessage{Mimetype: proto.String("image/jpeg"), FileSHA256: hash}
+	document := &waProto.DocumentMessage{Mimetype: proto.String("application/pdf"), FileName: proto.String("../secret.pdf"), FileSHA256: hash}
+
+	tests := []struct {
+		name string
+		msg  *waProto.Message
+		want string
+	}{
+		{"nil", nil, ""},
+		{"text", &waProto.Message{Conversation: proto.String("hi")}, ""},
+		{"image", &waProto.Message{ImageMessage: image}, "cafe.jpg"},
+		{"view once", &waProto.Message{ViewOnceMessage: &waProto.FutureProofMessage{
+			Message: &waProto.Message{ImageMessage: image},
+		}}, "cafe.jpg"},
+		{"view once v2", &waProto.Message{ViewOnceMessageV2: &waProto.FutureProofMessage{
+			Message: &waProto.Message{ImageMessage: image},
+		}}, "cafe.jpg"},
+		{"ephemeral view once", &waProto.Message{EphemeralMessage: &waProto.FutureProofMessage{
+			Message: &waProto.Message{ViewOnceMessageV2Extension: &waProto.FutureProofMessage{
+				Message: &waProto.Message{ImageMessage: image},
+			}},
+		}}, "cafe.jpg"},
+		{"ptv", &waProto.Message{PtvMessage: &waProto.VideoMessage{FileSHA256: hash}}, "cafe.mp4"},
+		{"gif", &waProto.Message{VideoMessage: &waProto.VideoMessage{
+			Mimetype: proto.String("video/mp4"), GifPlayback: proto.Bool(true), FileSHA256: hash,
+		}}, "cafe.mp4"},
+		{"voice note", &waProto.Message{AudioMessage: &waProto.AudioMessage{
+			Mimetype: proto.String("audio/ogg; codecs=opus"), PTT: proto.Bool(true), FileSHA256: hash,
+		}}, "cafe.ogg"},
+		{"sticker", &waProto.Message{StickerMessage: &waProto.StickerMessage{FileSHA256: hash}}, "cafe.webp"},
+		{"document", &waProto.Message{DocumentMessage: document}, "secret.pdf"},
+		{"document with caption", &waProto.Message{DocumentWithCaptionMessage: &waProto.FutureProofMessage{
+			Message: &waProto.Message{DocumentMessage: document},
+		}}, "secret.pdf"},
+		{"contact", &waProto.Message{ContactMessage: &waProto.ContactMessage{DisplayName: proto.String("Jane")}}, "Jane.vcf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attachmentFilename(tt.msg); got != tt.want {
+				t.Errorf("attachmentFilename() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,17 +2,18 @@ package controllers
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"io"
-	"log"
-	"net/http"
+	"log/slog"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/gabriel-vasile/mimetype"
 	"github.com/gofiber/fiber/v2"
 	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+	"github.com/hiddensetup/w/app/media"
 	"go.mau.fi/whatsmeow"
 	waProto "go.mau.fi/whatsmeow/binary/proto"
 	"go.mau.fi/whatsmeow/types"
@@ -23,45 +24,84 @@ type whatsappMessage struct {
 	Receiver string `json:"receiver"`
 	Message  string `json:"message"`
 	Media    string `json:"media"`
+	// Typing shows "typing…" before sending, for TypingDuration milliseconds
+	// or a duration computed from the message length.
+	Typing         bool `json:"typing"`
+	TypingDuration int  `json:"typingDuration"`
+	// PTT sends audio media as a voice note.
+	PTT bool `json:"ptt"`
+
+	// mediaData is a local file's content, sent instead of fetching Media.
+	mediaData []byte
 }
 
 func (k *Controller) SendMessage(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	logger := logging.FromContext(ctx)
+
 	mess := whatsappMessage{}
 	if err := c.BodyParser(&mess); err != nil {
-		k.client.Log.Errorf("Error parsing request body: %s", err.Error())
+		logger.Error("Parsing send request failed", "error", err)
 		return c.JSON(dto.Response{Status: false})
 	}
 
-	// Log the received JSON
-	receivedJSON, err := json.Marshal(mess)
-	if err != nil {
-		k.client.Log.Errorf("Error marshaling JSON: %s", err.Error())
-	} else {
-		k.client.Log.Infof("Received JSON: %s", receivedJSON)
-	}
+	logger.Debug("Send request", "receiver", mess.Receiver, "text", mess.Message, "media", mess.Media != "")
 
 	jid, ok := parseJID(mess.Receiver)
 	if !ok {
-		k.client.Log.Errorf("Invalid JID: %s", mess.Receiver)
+		logger.Error("Invalid receiver JID", "receiver", mess.Receiver)
 		return c.JSON(dto.Response{Status: false})
 	}
 
 	message, err := k.makeMessage(&mess)
 	if err != nil {
-		k.client.Log.Errorf("Error creating WhatsApp message: %s", err.Error())
-		return c.JSON(dto.Response{Status: false})
+		logger.Error("Creating WhatsApp message failed", "receiver", mess.Receiver, "error", err)
+		return c.JSON(dto.Response{Status: false, Error: err.Error()})
+	}
+
+	if mess.Typing {
+		k.simulateTyping(jid, mess.Message, time.Duration(mess.TypingDuration)*time.Millisecond)
 	}
 
-	_, err = k.client.SendMessage(context.Background(), jid, message)
+	_, err = k.sendMessage(ctx, jid, message)
 	if err != nil {
-		// Log the error
-		k.client.Log.Errorf("Error sending message: %s", err.Error())
 		return c.JSON(dto.Response{Status: false})
 	}
 
 	return c.JSON(dto.Response{Status: true})
 }
 
+// SendFile sends text, with the local file at path attached when path isn't
+// empty, for the send command.
+func (k *Controller) SendFile(ctx context.Context, receiver, text, path string) error {
+	jid, ok := parseJID(receiver)
+	if !ok {
+		return errors.New("invalid jid: " + receiver)
+	}
+
+	mess := whatsappMessage{Receiver: receiver, Message: text}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		mess.Media = "file://" + filepath.ToSlash(abs)
+		mess.mediaData = data
+	}
+
+	message, err := k.makeMessage(&mess)
+	if err != nil {
+		return err
+	}
+
+	_, err = k.sendMessage(ctx, jid, message)
+	return err
+}
+
 func (k *Controller) LastMessage(c *fiber.Ctx) error {
 	l := len(messageList)
 
@@ -76,28 +116,32 @@ func (k *Controller) makeMessage(input *whatsappMessage) (*waProto.Message, erro
 	message := waProto.Message{}
 
 	if len(input.Media) > 0 {
-		resp, err := http.Get(input.Media)
-		if err != nil {
-			return nil, errors.New("error getting media file by url")
+		file := input.mediaData
+		if file == nil {
+			var err error
+			file, err = k.mediaFetcher().Fetch(context.Background(), input.Media)
+			if err != nil {
+				return nil, errors.New("error getting media file by url: " + err.Error())
+			}
 		}
-		defer resp.Body.Close()
 
-		file, err := io.ReadAll(resp.Body)
+		prepared, err := media.Prepare(file, media.Options{
+			PTT:    input.PTT,
+			FFmpeg: k.config.Get().FFmpegPath,
+		})
 		if err != nil {
-			return nil, errors.New("error reading file body")
+			return nil, err
 		}
 
-		mtype := mimetype.Detect(file)
-		mimeType := mtype.String()
 		mess := ""
 		if len(input.Message) > 0 {
 			mess = input.Message
 		}
-		switch mimeType {
-		case "image/jpeg":
-			fallthrough
-		case "image/png":
-			resp, err := k.client.Upload(context.Background(), file, whatsmeow.MediaImage)
+		mimeType := prepared.MimeType
+
+		switch prepared.Kind {
+		case media.KindImage:
+			resp, err := k.upload(context.Background(), prepared.Data, whatsmeow.MediaImage)
 			if err != nil {
 				return nil, errors.New("error uploading image: " + err.Error())
 			}
@@ -111,24 +155,17 @@ func (k *Controller) makeMessage(input *whatsappMessage) (*waProto.Message, erro
 				FileEncSHA256: resp.FileEncSHA256,
 				FileSHA256:    resp.FileSHA256,
 				FileLength:    &resp.FileLength,
+				Width:         proto.Uint32(prepared.Width),
+				Height:        proto.Uint32(prepared.Height),
+				JPEGThumbnail: prepared.Thumbnail,
 			}
-		case "audio/ogg":
-			mimeType = "audio/ogg; codecs=opus"
-			fallthrough
-		case "audio/mp3":
-			fallthrough
-		case "audio/mp4":
-			fallthrough
-		case "audio/mpeg":
-			fallthrough
-		case "audio/amr":
-			resp, err := k.client.Upload(context.Background(), file, whatsmeow.MediaAudio)
+		case media.KindAudio:
+			resp, err := k.upload(context.Background(), prepared.Data, whatsmeow.MediaAudio)
 			if err != nil {
 				return nil, errors.New("error uploading file")
 			}
 
 			message.AudioMessage = &waProto.AudioMessage{
-				//	Caption:       proto.String(""),
 				Mimetype:      proto.String(mimeType),
 				URL:           &resp.URL,
 				DirectPath:    &resp.DirectPath,
@@ -136,9 +173,11 @@ func (k *Controller) makeMessage(input *whatsappMessage) (*waProto.Message, erro
 				FileEncSHA256: resp.FileEncSHA256,
 				FileSHA256:    resp.FileSHA256,
 				FileLength:    &resp.FileLength,
+				Seconds:       proto.Uint32(prepared.Seconds),
+				PTT:           proto.Bool(prepared.PTT),
 			}
-		case "video/mp4":
-			resp, err := k.client.Upload(context.Background(), file, whatsmeow.MediaVideo)
+		case media.KindVideo:
+			resp, err := k.upload(context.Background(), prepared.Data, whatsmeow.MediaVideo)
 			if err != nil {
 				return nil, errors.New("error uploading file")
 			}
@@ -152,9 +191,11 @@ func (k *Controller) makeMessage(input *whatsappMessage) (*waProto.Message, erro
 				FileEncSHA256: resp.FileEncSHA256,
 				FileSHA256:    resp.FileSHA256,
 				FileLength:    &resp.FileLength,
+				Seconds:       proto.Uint32(prepared.Seconds),
+				JPEGThumbnail: prepared.Thumbnail,
 			}
 		default:
-			resp, err := k.client.Upload(context.Background(), file, whatsmeow.MediaDocument)
+			resp, err := k.upload(context.Background(), prepared.Data, whatsmeow.MediaDocument)
 			if err != nil {
 				return nil, errors.New("error uploading file")
 			}
@@ -192,13 +233,12 @@ func parseJID(rec string) (types.JID, bool) {
 	} else {
 		recipient, err := types.ParseJID(rec)
 		if err != nil {
-			log.Printf("Invalid JID %s: %v", rec, err)
+			slog.Debug("Invalid JID", "jid", rec, "error", err)
 			return recipient, false
 		} else if recipient.User == "" {
-			log.Printf("Invalid JID %s: no server specified", rec)
+			slog.Debug("Invalid JID, no user", "jid", rec)
 			return recipient, false
 		}
-		log.Printf("JID OK: %s", recipient.String())
 		return recipient, true
 	}
 }
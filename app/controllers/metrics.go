@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/hiddensetup/w/app/logging"
+	"github.com/hiddensetup/w/app/metrics"
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// trackConnection updates the connection metrics from connection events.
+func (k *Controller) trackConnection(evt interface{}) {
+	switch evt.(type) {
+	case *events.Connected:
+		metrics.Connected.Set(1)
+		if atomic.SwapInt32(&k.connectedBefore, 1) == 1 {
+			metrics.Reconnects.Inc()
+		}
+	case *events.Disconnected, *events.LoggedOut, *events.StreamReplaced, *events.KeepAliveTimeout:
+		metrics.Connected.Set(0)
+	}
+}
+
+// sendMessage is client.SendMessage counting and logging sent messages. The
+// log entries carry the request ID when ctx comes from a request.
+func (k *Controller) sendMessage(ctx context.Context, to types.JID, message *waProto.Message) (whatsmeow.SendResponse, error) {
+	kind := messageType(message)
+	logger := logging.FromContext(ctx)
+
+	resp, err := k.client.SendMessage(ctx, to, message)
+	if err != nil {
+		metrics.SendFailures.WithLabelValues(kind).Inc()
+		logger.Error("Sending message failed", "chat", to.String(), "type", kind, "error", err)
+	} else {
+		metrics.MessagesSent.WithLabelValues(kind).Inc()
+		logger.Info("Message sent", "chat", to.String(), "type", kind, "message_id", resp.ID)
+	}
+
+	return resp, err
+}
+
+// upload is client.Upload counting uploaded bytes.
+func (k *Controller) upload(ctx context.Context, data []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	resp, err := k.client.Upload(ctx, data, appInfo)
+	if err == nil {
+		metrics.MediaUploadedBytes.Add(float64(len(data)))
+	}
+
+	return resp, err
+}
+
+// download is client.Download counting downloaded bytes.
+func (k *Controller) download(msg whatsmeow.DownloadableMessage) ([]byte, error) {
+	data, err := k.client.Download(msg)
+	if err == nil {
+		metrics.MediaDownloadedBytes.Add(float64(len(data)))
+	}
+
+	return data, err
+}
+
+// messageType is the metrics label for a message.
+func messageType(msg *waProto.Message) string {
+	msg = unwrapMessage(msg)
+
+	switch {
+	case msg == nil:
+		return "other"
+	case msg.Conversation != nil, msg.ExtendedTextMessage != nil:
+		return "text"
+	case msg.ImageMessage != nil:
+		return "image"
+	case msg.VideoMessage != nil, msg.PtvMessage != nil:
+		return "video"
+	case msg.AudioMessage != nil:
+		return "audio"
+	case msg.DocumentMessage != nil:
+		return "document"
+	case msg.StickerMessage != nil:
+		return "sticker"
+	case msg.ReactionMessage != nil:
+		return "reaction"
+	case msg.LocationMessage != nil, msg.LiveLocationMessage != nil:
+		return "location"
+	case msg.ContactMessage != nil, msg.ContactsArrayMessage != nil:
+		return "contact"
+	}
+
+	return "other"
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const (
+	typingPerCharacter = 50 * time.Millisecond
+	minTypingDuration  = time.Second
+	maxTypingDuration  = 8 * time.Second
+)
+
+func (k *Controller) SetPresence(c *fiber.Ctx) error {
+	req := dto.PresenceRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	presence := types.Presence(req.State)
+	if presence != types.PresenceAvailable && presence != types.PresenceUnavailable {
+		return fail(c, fiber.StatusBadRequest, errors.New("state must be available or unavailable"))
+	}
+
+	if err := k.client.SendPresence(presence); err != nil {
+		logging.FromContext(c.UserContext()).Error("Sending presence failed", "error", err)
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
+
+// SetChatPresence shows composing or recording in a chat, paused clears it.
+func (k *Controller) SetChatPresence(c *fiber.Ctx) error {
+	req := dto.ChatPresenceRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	jid, ok := parseJID(req.JID)
+	if !ok {
+		return fail(c, fiber.StatusBadRequest, errors.New("invalid jid"))
+	}
+
+	state, media := types.ChatPresenceComposing, types.ChatPresenceMediaText
+	switch req.State {
+	case "composing":
+	case "recording":
+		media = types.ChatPresenceMediaAudio
+	case "paused":
+		state = types.ChatPresencePaused
+	default:
+		return fail(c, fiber.StatusBadRequest, errors.New("state must be composing, recording or paused"))
+	}
+
+	if err := k.client.SendChatPresence(jid, state, media); err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
+
+// SubscribePresence asks WhatsApp for the contact's presence updates, which
+// are then forwarded as presence events.
+func (k *Controller) SubscribePresence(c *fiber.Ctx) error {
+	jid, ok := parseJID(c.Params(`jid`))
+	if !ok {
+		return fail(c, fiber.StatusBadRequest, errors.New("invalid jid"))
+	}
+
+	if err := k.client.SubscribePresence(jid); err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
+
+// simulateTyping shows "typing…" in the chat for the given duration, or one
+// computed from the text length when it's zero.
+func (k *Controller) simulateTyping(jid types.JID, text string, duration time.Duration) {
+	if duration <= 0 {
+		duration = time.Duration(len([]rune(text))) * typingPerCharacter
+	}
+	if duration < minTypingDuration {
+		duration = minTypingDuration
+	}
+	if duration > maxTypingDuration {
+		duration = maxTypingDuration
+	}
+
+	if err := k.client.SendChatPresence(jid, types.ChatPresenceComposing, types.ChatPresenceMediaText); err != nil {
+		slog.Warn("Sending typing presence failed", "chat", jid.String(), "error", err)
+		return
+	}
+
+	time.Sleep(duration)
+
+	if err := k.client.SendChatPresence(jid, types.ChatPresencePaused, types.ChatPresenceMediaText); err != nil {
+		slog.Warn("Clearing typing presence failed", "chat", jid.String(), "error", err)
+	}
+}
+
+func presenceEvent(v *events.Presence) dto.PresenceEvent {
+	state := string(types.PresenceAvailable)
+	if v.Unavailable {
+		state = string(types.PresenceUnavailable)
+	}
+
+	event := dto.PresenceEvent{
+		Event:     "presence",
+		JID:       v.From.String(),
+		State:     state,
+		Timestamp: time.Now().String(),
+	}
+	if !v.LastSeen.IsZero() {
+		event.LastSeen = v.LastSeen.String()
+	}
+
+	return event
+}
+
+func chatPresenceEvent(v *events.ChatPresence) dto.PresenceEvent {
+	state := string(v.State)
+	if v.State == types.ChatPresenceComposing && v.Media == types.ChatPresenceMediaAudio {
+		state = "recording"
+	}
+
+	return dto.PresenceEvent{
+		Event:     "chat_presence",
+		JID:       v.Sender.String(),
+		Chat:      v.Chat.String(),
+		State:     state,
+		Timestamp: time.Now().String(),
+	}
+}
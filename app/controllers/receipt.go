@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// MarkRead sends read receipts for messages in a chat. In groups the sender
+// of the messages must be given as well.
+func (k *Controller) MarkRead(c *fiber.Ctx) error {
+	req := dto.MarkReadRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	chat, ok := parseJID(req.Chat)
+	if !ok {
+		return fail(c, fiber.StatusBadRequest, errors.New("invalid chat jid"))
+	}
+	if len(req.IDs) == 0 {
+		return fail(c, fiber.StatusBadRequest, errors.New("no message ids given"))
+	}
+
+	var sender types.JID
+	if req.Sender != "" {
+		if sender, ok = parseJID(req.Sender); !ok {
+			return fail(c, fiber.StatusBadRequest, errors.New("invalid sender jid"))
+		}
+	} else if chat.Server == types.GroupServer {
+		return fail(c, fiber.StatusBadRequest, errors.New("sender is required for group chats"))
+	}
+
+	ids := make([]types.MessageID, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		ids = append(ids, types.MessageID(id))
+	}
+
+	if err := k.client.MarkRead(ids, time.Now(), chat, sender); err != nil {
+		logging.FromContext(c.UserContext()).Error("Marking messages read failed", "chat", chat.String(), "error", err)
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
+
+// autoMarkRead applies the read policy to an incoming message after it was
+// proxied, delivered tells whether the webhook accepted it.
+func (k *Controller) autoMarkRead(v *events.Message, delivered bool) {
+	if v.Info.IsFromMe {
+		return
+	}
+
+	switch k.readSettings().Policy {
+	case ReadPolicyAlways:
+	case ReadPolicyDelivered:
+		if !delivered {
+			return
+		}
+	default:
+		return
+	}
+
+	if err := k.client.MarkRead([]types.MessageID{v.Info.ID}, time.Now(), v.Info.Chat, v.Info.Sender); err != nil {
+		slog.Error("Auto marking message read failed", "message_id", v.Info.ID, "error", err)
+	}
+}
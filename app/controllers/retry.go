@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/logging"
+	"github.com/hiddensetup/w/app/media"
+	"github.com/hiddensetup/w/app/store"
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+const mediaRetryTimeout = 30 * time.Second
+
+// mediaRetries routes MediaRetry events to the requests waiting for them.
+// Several requests can wait on the same message, each gets the event.
+type mediaRetries struct {
+	mu      sync.Mutex
+	waiting map[types.MessageID][]chan *events.MediaRetry
+}
+
+func newMediaRetries() *mediaRetries {
+	return &mediaRetries{waiting: make(map[types.MessageID][]chan *events.MediaRetry)}
+}
+
+func (r *mediaRetries) wait(id types.MessageID) chan *events.MediaRetry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ch := make(chan *events.MediaRetry, 1)
+	r.waiting[id] = append(r.waiting[id], ch)
+	return ch
+}
+
+// done removes the channel returned by wait, leaving the other waiters of
+// the message alone.
+func (r *mediaRetries) done(id types.MessageID, ch chan *events.MediaRetry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	waiters := r.waiting[id]
+	for i, waiter := range waiters {
+		if waiter == ch {
+			waiters = append(waiters[:i:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(r.waiting, id)
+	} else {
+		r.waiting[id] = waiters
+	}
+}
+
+func (r *mediaRetries) deliver(evt *events.MediaRetry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, ch := range r.waiting[evt.MessageID] {
+		select {
+		case ch <- evt:
+		default:
+		}
+	}
+}
+
+// saveMessage keeps the message metadata needed to download its media later.
+func (k *Controller) saveMessage(v *events.Message) {
+	raw, err := proto.Marshal(v.Message)
+	if err != nil {
+		slog.Error("Encoding message failed", "message_id", v.Info.ID, "error", err)
+		return
+	}
+
+	err = k.store.SaveMessage(store.Message{
+		ID:        v.Info.ID,
+		Chat:      v.Info.Chat.String(),
+		Sender:    v.Info.Sender.String(),
+		PushName:  v.Info.PushName,
+		IsFromMe:  v.Info.IsFromMe,
+		IsGroup:   v.Info.IsGroup,
+		Timestamp: v.Info.Timestamp,
+		MediaType: v.Info.MediaType,
+		Raw:       raw,
+	})
+	if err != nil {
+		slog.Error("Saving message failed", "message_id", v.Info.ID, "error", err)
+	}
+}
+
+// MessageMedia downloads the attachment of a stored message again. When the
+// CDN copy has expired the phone is asked to re-upload it first.
+func (k *Controller) MessageMedia(c *fiber.Ctx) error {
+	rec, err := k.store.Message(c.Params(`id`), c.Query(`chat`))
+	if err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	msg := &waProto.Message{}
+	if err := proto.Unmarshal(rec.Raw, msg); err != nil {
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+
+	file := downloadable(msg)
+	if file == nil {
+		return fail(c, fiber.StatusNotFound, errors.New("message has no media"))
+	}
+
+	var data []byte
+	if k.media != nil {
+		if id := media.ID(file.GetFileSHA256()); k.media.Has(id) {
+			data, err = k.media.Read(id)
+		}
+	}
+
+	if data == nil {
+		data, err = k.download(file)
+		if errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith404) || errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith410) {
+			data, err = k.retryMediaDownload(rec, msg, file)
+		}
+		if err == nil && k.media != nil {
+			if _, err := k.media.Save(data); err != nil {
+				logging.FromContext(c.UserContext()).Error("Storing media failed", "error", err)
+			}
+		}
+	}
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Re-downloading media failed", "message_id", rec.ID, "error", err)
+		return fail(c, fiber.StatusBadGateway, err)
+	}
+
+	mimeType := mimetype.Detect(data).String()
+	c.Set(fiber.HeaderContentType, mimeType)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	if filename := attachmentFilename(msg); filename != "" {
+		c.Set(fiber.HeaderContentDisposition, "attachment; filename="+strconv.Quote(filename))
+	} else {
+		c.Set(fiber.HeaderContentDisposition, attachmentDisposition(rec.ID, mimeType))
+	}
+
+	return c.Send(data)
+}
+
+func (k *Controller) retryMediaDownload(rec store.Message, msg *waProto.Message, file whatsmeow.DownloadableMessage) ([]byte, error) {
+	chat, err := types.ParseJID(rec.Chat)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := types.ParseJID(rec.Sender)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     chat,
+			Sender:   sender,
+			IsFromMe: rec.IsFromMe,
+			IsGroup:  rec.IsGroup,
+		},
+		ID:        rec.ID,
+		Timestamp: rec.Timestamp,
+	}
+
+	ch := k.mediaRetries.wait(rec.ID)
+	defer k.mediaRetries.done(rec.ID, ch)
+
+	if err := k.client.SendMediaRetryReceipt(info, file.GetMediaKey()); err != nil {
+		return nil, fmt.Errorf("requesting media retry: %w", err)
+	}
+
+	var evt *events.MediaRetry
+	select {
+	case evt = <-ch:
+	case <-time.After(mediaRetryTimeout):
+		return nil, errors.New("timed out waiting for the phone to re-upload the media")
+	}
+
+	retry, err := whatsmeow.DecryptMediaRetryNotification(evt, file.GetMediaKey())
+	if err != nil {
+		return nil, err
+	}
+	if retry.GetResult() != waProto.MediaRetryNotification_SUCCESS {
+		return nil, fmt.Errorf("media retry failed: %s", retry.GetResult())
+	}
+
+	setDirectPath(msg, retry.GetDirectPath())
+
+	data, err := k.download(downloadable(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the new path, so the next re-download doesn't need a retry.
+	if raw, err := proto.Marshal(msg); err == nil {
+		rec.Raw = raw
+		if err := k.store.SaveMessage(rec); err != nil {
+			slog.Error("Updating message failed", "message_id", rec.ID, "error", err)
+		}
+	}
+
+	return data, nil
+}
+
+// setDirectPath points the message's media at a re-uploaded copy. The URL is
+// cleared, as whatsmeow prefers it over the direct path. The media is found
+// like downloadable finds it, inside wrappers and product messages too.
+func setDirectPath(msg *waProto.Message, directPath string) {
+	switch file := downloadable(msg).(type) {
+	case *waProto.ImageMessage:
+		file.URL, file.DirectPath = nil, proto.String(directPath)
+	case *waProto.VideoMessage:
+		file.URL, file.DirectPath = nil, proto.String(directPath)
+	case *waProto.AudioMessage:
+		file.URL, file.DirectPath = nil, proto.String(directPath)
+	case *waProto.DocumentMessage:
+		file.URL, file.DirectPath = nil, proto.String(directPath)
+	case *waProto.StickerMessage:
+		file.URL, file.DirectPath = nil, proto.String(directPath)
+	}
+}
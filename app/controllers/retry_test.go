@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"testing"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMediaRetriesConcurrentWaiters(t *testing.T) {
+	r := newMediaRetries()
+
+	first := r.wait("ABC")
+	second := r.wait("ABC")
+	r.done("ABC", first)
+
+	evt := &events.MediaRetry{MessageID: "ABC"}
+	r.deliver(evt)
+
+	select {
+	case got := <-second:
+		if got != evt {
+			t.Errorf("second waiter got %v, want %v", got, evt)
+		}
+	default:
+		t.Fatal("second waiter got nothing after the first one finished")
+	}
+	select {
+	case <-first:
+		t.Error("finished waiter still got the event")
+	default:
+	}
+
+	r.done("ABC", second)
+	if _, ok := r.waiting["ABC"]; ok {
+		t.Error("message still has waiters after all finished")
+	}
+}
+
+func TestSetDirectPath(t *testing.T) {
+	image := &waProto.ImageMessage{URL: proto.String("https://mmg.whatsapp.net/old"), DirectPath: proto.String("/old")}
+	ptv := &waProto.VideoMessage{DirectPath: proto.String("/old")}
+	product := &waProto.ImageMessage{DirectPath: proto.String("/old")}
+
+	tests := []struct {
+		name string
+		msg  *waProto.Message
+		file interface {
+			GetURL() string
+			GetDirectPath() string
+		}
+	}{
+		{"image", &waProto.Message{ImageMessage: image}, image},
+		{"ephemeral image", &waProto.Message{EphemeralMessage: &waProto.FutureProofMessage{
+			Message: &waProto.Message{ImageMessage: image},
+		}}, image},
+		{"view once image", &waProto.Message{ViewOnceMessageV2: &waProto.FutureProofMessage{
+			Message: &waProto.Message{ImageMessage: image},
+		}}, image},
+		{"ptv", &waProto.Message{PtvMessage: ptv}, ptv},
+		{"product image", &waProto.Message{ProductMessage: &waProto.ProductMessage{
+			Product: &waProto.ProductMessage_ProductSnapshot{ProductImage: product},
+		}}, product},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setDirectPath(tt.msg, "/new")
+
+			if got := tt.file.GetDirectPath(); got != "/new" {
+				t.Errorf("DirectPath = %q, want %q", got, "/new")
+			}
+			if got := tt.file.GetURL(); got != "" {
+				t.Errorf("URL = %q, want it cleared", got)
+			}
+		})
+	}
+}
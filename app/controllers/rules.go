@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+	"github.com/hiddensetup/w/app/rules"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+func (k *Controller) loadRules() error {
+	list, err := k.store.Rules()
+	if err != nil {
+		return err
+	}
+
+	k.rules.Load(list)
+
+	return nil
+}
+
+func (k *Controller) Rules(c *fiber.Ctx) error {
+	return c.JSON(k.rules.Rules())
+}
+
+func (k *Controller) CreateRule(c *fiber.Ctx) error {
+	rule := rules.Rule{Enabled: true}
+	if err := c.BodyParser(&rule); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+	rule.ID = 0
+
+	if err := k.saveRule(&rule); err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+func (k *Controller) UpdateRule(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params(`id`), 10, 64)
+	if err != nil || id <= 0 {
+		return fail(c, fiber.StatusBadRequest, errors.New("invalid rule id"))
+	}
+
+	rule := rules.Rule{}
+	if err := c.BodyParser(&rule); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+	rule.ID = id
+
+	if err := k.saveRule(&rule); err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(rule)
+}
+
+func (k *Controller) DeleteRule(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params(`id`), 10, 64)
+	if err != nil || id <= 0 {
+		return fail(c, fiber.StatusBadRequest, errors.New("invalid rule id"))
+	}
+
+	if err := k.store.DeleteRule(id); err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	if err := k.loadRules(); err != nil {
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+
+	return c.JSON(dto.Response{Status: true})
+}
+
+// ReloadRules re-reads the rules from the database, for when they were
+// changed there directly.
+func (k *Controller) ReloadRules(c *fiber.Ctx) error {
+	if err := k.loadRules(); err != nil {
+		logging.FromContext(c.UserContext()).Error("Reloading rules failed", "error", err)
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+
+	return c.JSON(k.rules.Rules())
+}
+
+func (k *Controller) saveRule(rule *rules.Rule) error {
+	if err := rule.Validate(); err != nil {
+		return badRequest(err)
+	}
+
+	if err := k.store.SaveRule(rule); err != nil {
+		return err
+	}
+
+	return k.loadRules()
+}
+
+// autoReply sends a rule's reply. ctx carries the logger of the message
+// that triggered it.
+func (k *Controller) autoReply(ctx context.Context, chat types.JID, text string) {
+	k.outbox.Add(1)
+	defer k.outbox.Done()
+
+	k.sendMessage(ctx, chat, &waProto.Message{
+		Conversation: proto.String(text),
+	})
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/skip2/go-qrcode"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Session reports whether the gateway is logged in and connected.
+func (k *Controller) Session(c *fiber.Ctx) error {
+	return c.JSON(k.SessionStatus())
+}
+
+func (k *Controller) SessionStatus() dto.SessionStatus {
+	status := dto.SessionStatus{
+		LoggedIn:  k.client.Store.ID != nil,
+		Connected: k.client.IsConnected(),
+		History:   k.history.get(),
+	}
+
+	if k.client.Store.ID != nil {
+		status.JID = k.client.Store.ID.String()
+		status.PushName = k.client.Store.PushName
+		status.Platform = k.client.Store.Platform
+	}
+
+	return status
+}
+
+// LoginTerminal links a new device for the login command. The QR code is
+// printed to out, or, when phone is given, a pairing code to enter on that
+// phone instead.
+func (k *Controller) LoginTerminal(ctx context.Context, out io.Writer, phone string) error {
+	if k.client.Store.ID != nil {
+		return errors.New("already logged in as " + k.client.Store.ID.User)
+	}
+
+	qrChan, err := k.client.GetQRChannel(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := k.client.Connect(); err != nil {
+		return err
+	}
+
+	pairing := false
+	for evt := range qrChan {
+		switch evt.Event {
+		case whatsmeow.QRChannelEventCode:
+			if phone == "" {
+				qr, err := qrcode.New(evt.Code, qrcode.Low)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(out, qr.ToSmallString(false))
+				fmt.Fprintln(out, "Scan the QR code with WhatsApp > Linked devices.")
+				continue
+			}
+
+			// The code can only be requested once the QR login started.
+			if !pairing {
+				code, err := k.client.PairPhone(strings.TrimPrefix(phone, "+"), true, whatsmeow.PairClientChrome, "Chrome (Linux)")
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "Enter the code %s in WhatsApp > Linked devices > Link with phone number.\n", code)
+				pairing = true
+			}
+		case whatsmeow.QRChannelSuccess.Event:
+			return nil
+		case whatsmeow.QRChannelTimeout.Event:
+			return errors.New("login timed out")
+		default:
+			if evt.Error != nil {
+				return evt.Error
+			}
+			return errors.New("login failed: " + evt.Event)
+		}
+	}
+
+	return errors.New("login cancelled")
+}
+
+// CheckNumbers looks up which phone numbers are on WhatsApp.
+func (k *Controller) CheckNumbers(numbers []string) ([]types.IsOnWhatsAppResponse, error) {
+	phones := make([]string, 0, len(numbers))
+	for _, number := range numbers {
+		phones = append(phones, `+`+strings.TrimPrefix(number, "+"))
+	}
+
+	return k.client.IsOnWhatsApp(phones)
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Group handling modes. In structured mode the sender isn't baked into the
+// conversation text, consumers use the Sender and SenderName fields instead.
+const (
+	GroupModeAll       = "all"
+	GroupModeAllowlist = "allowlist"
+	GroupModeIgnore    = "ignore"
+)
+
+// Auto-read policies. With ReadPolicyDelivered incoming messages are marked
+// as read once the webhook answered them with 200.
+const (
+	ReadPolicyNever     = "never"
+	ReadPolicyDelivered = "delivered"
+	ReadPolicyAlways    = "always"
+)
+
+const (
+	groupSettingsKey = "groups"
+	readSettingsKey  = "read"
+)
+
+// settings holds the runtime settings of the session, persisted in the
+// gateway store and changeable through the settings endpoints.
+type settings struct {
+	mu     sync.RWMutex
+	groups dto.GroupSettings
+	read   dto.ReadSettings
+}
+
+func (k *Controller) loadSettings() error {
+	groups := dto.GroupSettings{Mode: GroupModeAll}
+	if _, err := k.store.GetSetting(groupSettingsKey, &groups); err != nil {
+		return err
+	}
+
+	read := dto.ReadSettings{Policy: ReadPolicyNever}
+	if _, err := k.store.GetSetting(readSettingsKey, &read); err != nil {
+		return err
+	}
+
+	k.settings.mu.Lock()
+	k.settings.groups = groups
+	k.settings.read = read
+	k.settings.mu.Unlock()
+
+	return nil
+}
+
+func (k *Controller) groupSettings() dto.GroupSettings {
+	k.settings.mu.RLock()
+	defer k.settings.mu.RUnlock()
+
+	return k.settings.groups
+}
+
+// groupAllowed reports whether messages from the group chat are forwarded.
+func (k *Controller) groupAllowed(chat types.JID) bool {
+	groups := k.groupSettings()
+
+	switch groups.Mode {
+	case GroupModeIgnore:
+		return false
+	case GroupModeAllowlist:
+		for _, jid := range groups.Allowlist {
+			if jid == chat.String() {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func (k *Controller) GroupSettings(c *fiber.Ctx) error {
+	return c.JSON(k.groupSettings())
+}
+
+func (k *Controller) UpdateGroupSettings(c *fiber.Ctx) error {
+	groups := dto.GroupSettings{}
+	if err := c.BodyParser(&groups); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	switch groups.Mode {
+	case GroupModeAll, GroupModeAllowlist, GroupModeIgnore:
+	default:
+		return fail(c, fiber.StatusBadRequest, errors.New("mode must be all, allowlist or ignore"))
+	}
+
+	allowlist := make([]string, 0, len(groups.Allowlist))
+	for _, item := range groups.Allowlist {
+		jid, err := parseGroupJID(item)
+		if err != nil {
+			return fail(c, fiber.StatusBadRequest, err)
+		}
+		allowlist = append(allowlist, jid.String())
+	}
+	groups.Allowlist = allowlist
+
+	if err := k.store.PutSetting(groupSettingsKey, groups); err != nil {
+		logging.FromContext(c.UserContext()).Error("Saving group settings failed", "error", err)
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+
+	k.settings.mu.Lock()
+	k.settings.groups = groups
+	k.settings.mu.Unlock()
+
+	return c.JSON(groups)
+}
+
+func (k *Controller) readSettings() dto.ReadSettings {
+	k.settings.mu.RLock()
+	defer k.settings.mu.RUnlock()
+
+	return k.settings.read
+}
+
+func (k *Controller) ReadSettings(c *fiber.Ctx) error {
+	return c.JSON(k.readSettings())
+}
+
+func (k *Controller) UpdateReadSettings(c *fiber.Ctx) error {
+	read := dto.ReadSettings{}
+	if err := c.BodyParser(&read); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+
+	switch read.Policy {
+	case ReadPolicyNever, ReadPolicyDelivered, ReadPolicyAlways:
+	default:
+		return fail(c, fiber.StatusBadRequest, errors.New("policy must be never, delivered or always"))
+	}
+
+	if err := k.store.PutSetting(readSettingsKey, read); err != nil {
+		logging.FromContext(c.UserContext()).Error("Saving read settings failed", "error", err)
+		return fail(c, fiber.StatusInternalServerError, err)
+	}
+
+	k.settings.mu.Lock()
+	k.settings.read = read
+	k.settings.mu.Unlock()
+
+	return c.JSON(read)
+}
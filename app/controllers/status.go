@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultStatusBackground = 0xFF1E6E4F
+	defaultStatusTextColor  = 0xFFFFFFFF
+)
+
+// handleStatus forwards a status update to STATUS_PROXY_URL and the event
+// stream. Its media is only downloaded when STATUS_PROXY_URL is set.
+func (k *Controller) handleStatus(v *events.Message) {
+	proxyURL := k.config.Get().StatusProxyURL
+
+	update := dto.StatusUpdate{
+		Event:      "status",
+		ID:         v.Info.ID,
+		Sender:     v.Info.Sender.String(),
+		SenderName: v.Info.PushName,
+		IsFromMe:   v.Info.IsFromMe,
+		Timestamp:  v.Info.Timestamp.String(),
+		MediaType:  v.Info.MediaType,
+		Text:       v.Message.GetConversation(),
+	}
+
+	if update.Text == "" {
+		update.Text = v.Message.GetExtendedTextMessage().GetText()
+	}
+	if v.Message.ImageMessage != nil {
+		update.Caption = v.Message.ImageMessage.GetCaption()
+	}
+	if v.Message.VideoMessage != nil {
+		update.Caption = v.Message.VideoMessage.GetCaption()
+	}
+
+	if proxyURL == "" {
+		k.publishEvent(update)
+		return
+	}
+
+	var attachment dto.MessageAttachment
+	if update.MediaType != "" {
+		attachment = k.loadAttachment(v.Message)
+		if attachment.MediaID != "" {
+			update.MediaURL = k.mediaURL(attachment.MediaID)
+		}
+	}
+
+	k.publishEvent(update)
+	k.postToChatApp(proxyURL, update, attachment)
+}
+
+// PostStatus publishes a text, image or video status. WhatsApp delivers it to
+// the audience chosen in the phone's status privacy settings, see StatusPrivacy.
+// The audience can't be picked per post: whatsmeow resolves the recipients
+// from those settings, so a recipients list is refused rather than ignored.
+func (k *Controller) PostStatus(c *fiber.Ctx) error {
+	req := dto.StatusRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, fiber.StatusBadRequest, err)
+	}
+	if len(req.Recipients) > 0 {
+		return fail(c, fiber.StatusNotImplemented,
+			errors.New("a per-status audience is not supported, change the status privacy on the phone"))
+	}
+
+	var message *waProto.Message
+	if req.Media != "" {
+		var err error
+		message, err = k.makeMessage(&whatsappMessage{Message: req.Message, Media: req.Media})
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("Creating status message failed", "error", err)
+			return fail(c, fiber.StatusBadRequest, err)
+		}
+		if message.ImageMessage == nil && message.VideoMessage == nil {
+			return fail(c, fiber.StatusBadRequest, errors.New("status media must be an image or a video"))
+		}
+	} else {
+		if strings.TrimSpace(req.Message) == "" {
+			return fail(c, fiber.StatusBadRequest, errors.New("message or media is required"))
+		}
+
+		background, err := parseARGB(req.BackgroundColor, defaultStatusBackground)
+		if err != nil {
+			return fail(c, fiber.StatusBadRequest, err)
+		}
+		textColor, err := parseARGB(req.TextColor, defaultStatusTextColor)
+		if err != nil {
+			return fail(c, fiber.StatusBadRequest, err)
+		}
+
+		message = &waProto.Message{
+			ExtendedTextMessage: &waProto.ExtendedTextMessage{
+				Text:           proto.String(req.Message),
+				BackgroundArgb: proto.Uint32(background),
+				TextArgb:       proto.Uint32(textColor),
+				Font:           waProto.ExtendedTextMessage_FontType(req.Font).Enum(),
+			},
+		}
+	}
+
+	resp, err := k.sendMessage(c.UserContext(), types.StatusBroadcastJID, message)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Posting status failed", "error", err)
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(dto.StatusResponse{Status: true, ID: resp.ID})
+}
+
+// StatusPrivacy returns the status audiences configured on the phone. The
+// default one is used when posting.
+func (k *Controller) StatusPrivacy(c *fiber.Ctx) error {
+	privacy, err := k.client.GetStatusPrivacy()
+	if err != nil {
+		return fail(c, errorStatus(err), err)
+	}
+
+	return c.JSON(privacy)
+}
+
+// parseARGB parses "#RRGGBB" or "#AARRGGBB" colors.
+func parseARGB(value string, fallback uint32) (uint32, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "#")
+	if value == "" {
+		return fallback, nil
+	}
+
+	color, err := strconv.ParseUint(value, 16, 32)
+	if err != nil || (len(value) != 6 && len(value) != 8) {
+		return 0, errors.New("invalid color: " + value)
+	}
+	if len(value) == 6 {
+		color |= 0xFF000000
+	}
+
+	return uint32(color), nil
+}
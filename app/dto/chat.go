@@ -0,0 +1,47 @@
+package dto
+
+type ArchiveChatRequest struct {
+	Archive bool `json:"archive"`
+}
+
+type PinChatRequest struct {
+	Pin bool `json:"pin"`
+}
+
+// MuteChatRequest mutes until Until, an RFC 3339 time, or for good when it's
+// empty.
+type MuteChatRequest struct {
+	Mute  bool   `json:"mute"`
+	Until string `json:"until"`
+}
+
+type MarkChatRequest struct {
+	Read bool `json:"read"`
+}
+
+// ChatEvent is forwarded to PROXY_URL when a chat is archived ("chat_archive"),
+// pinned ("chat_pin"), muted ("chat_mute"), marked read or unread
+// ("chat_read"), cleared ("chat_clear") or deleted ("chat_delete") on the
+// phone. Value is the new state, MutedUntil is only set for mutes.
+type ChatEvent struct {
+	Event      string `json:"event"`
+	JID        string `json:"jid"`
+	Value      bool   `json:"value"`
+	MutedUntil string `json:"mutedUntil"`
+	Timestamp  string `json:"timestamp"`
+}
+
+// LabelEvent is forwarded to PROXY_URL when a label is created, changed or
+// deleted ("label_edit"), or put on or taken off a chat ("label_chat") or a
+// message ("label_message") on the phone.
+type LabelEvent struct {
+	Event     string `json:"event"`
+	LabelID   string `json:"labelId"`
+	Name      string `json:"name"`
+	Color     int32  `json:"color"`
+	Deleted   bool   `json:"deleted"`
+	JID       string `json:"jid"`
+	MessageID string `json:"messageId"`
+	Labeled   bool   `json:"labeled"`
+	Timestamp string `json:"timestamp"`
+}
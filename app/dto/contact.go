@@ -0,0 +1,48 @@
+package dto
+
+type ContactProfile struct {
+	JID          string           `json:"jid"`
+	About        string           `json:"about"`
+	PictureID    string           `json:"pictureId"`
+	PictureURL   string           `json:"pictureUrl"`
+	IsBusiness   bool             `json:"isBusiness"`
+	VerifiedName string           `json:"verifiedName"`
+	Business     *BusinessProfile `json:"business,omitempty"`
+}
+
+type BusinessProfile struct {
+	Address       string            `json:"address"`
+	Email         string            `json:"email"`
+	Description   string            `json:"description"`
+	Websites      []string          `json:"websites"`
+	Categories    []string          `json:"categories"`
+	Options       map[string]string `json:"options"`
+	HoursTimeZone string            `json:"hoursTimeZone"`
+	Hours         []BusinessHours   `json:"hours"`
+}
+
+type BusinessHours struct {
+	DayOfWeek string `json:"dayOfWeek"`
+	Mode      string `json:"mode"`
+	OpenTime  string `json:"openTime"`
+	CloseTime string `json:"closeTime"`
+}
+
+type Contact struct {
+	JID          string `json:"jid"`
+	Found        bool   `json:"found"`
+	FirstName    string `json:"firstName"`
+	FullName     string `json:"fullName"`
+	PushName     string `json:"pushName"`
+	BusinessName string `json:"businessName"`
+}
+
+// ContactEvent is forwarded to PROXY_URL when WhatsApp reports a changed
+// push name, business name or address book entry.
+type ContactEvent struct {
+	Event     string `json:"event"`
+	JID       string `json:"jid"`
+	OldName   string `json:"oldName"`
+	NewName   string `json:"newName"`
+	Timestamp string `json:"timestamp"`
+}
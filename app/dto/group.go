@@ -0,0 +1,44 @@
+package dto
+
+type Group struct {
+	JID               string             `json:"jid"`
+	Name              string             `json:"name"`
+	Topic             string             `json:"topic"`
+	TopicID           string             `json:"topicId"`
+	Owner             string             `json:"owner"`
+	IsLocked          bool               `json:"isLocked"`
+	IsAnnounce        bool               `json:"isAnnounce"`
+	IsEphemeral       bool               `json:"isEphemeral"`
+	DisappearingTimer uint32             `json:"disappearingTimer"`
+	Created           string             `json:"created"`
+	Participants      []GroupParticipant `json:"participants"`
+}
+
+type GroupParticipant struct {
+	JID          string `json:"jid"`
+	DisplayName  string `json:"displayName"`
+	IsAdmin      bool   `json:"isAdmin"`
+	IsSuperAdmin bool   `json:"isSuperAdmin"`
+	Error        int    `json:"error,omitempty"`
+}
+
+type CreateGroupRequest struct {
+	Name         string   `json:"name"`
+	Participants []string `json:"participants"`
+}
+
+type GroupParticipantsRequest struct {
+	Participants []string `json:"participants"`
+}
+
+type GroupTextRequest struct {
+	Text string `json:"text"`
+}
+
+type GroupInviteResponse struct {
+	Link string `json:"link"`
+}
+
+type JoinGroupRequest struct {
+	Code string `json:"code"`
+}
@@ -0,0 +1,14 @@
+package dto
+
+import "github.com/hiddensetup/w/app/store"
+
+type CreateAPIKeyRequest struct {
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes"`
+	Sessions []string `json:"sessions"`
+}
+
+type CreateAPIKeyResponse struct {
+	store.APIKey
+	Secret string `json:"secret"`
+}
@@ -14,14 +14,50 @@ type IncomingMessage struct {
 	MediaType    string                 `json:"mediaType"`
 	Multicast    bool                   `json:"multicast"`
 	Conversation string                 `json:"conversation"`
+	Tags         string                 `json:"tags"`
+	MediaURL     string                 `json:"mediaUrl"`
 	ExtraFields  map[string]interface{} `json:"-"`
 }
 
+// HistoryMessage is posted to HISTORY_PROXY_URL for each message of the history
+// sync. Historical is always true, to tell them apart from live messages.
+type HistoryMessage struct {
+	ID           string `json:"id"`
+	Chat         string `json:"chat"`
+	Sender       string `json:"sender"`
+	SenderName   string `json:"senderName"`
+	IsFromMe     bool   `json:"isFromMe"`
+	IsGroup      bool   `json:"isGroup"`
+	Timestamp    string `json:"timestamp"`
+	MediaType    string `json:"mediaType"`
+	Conversation string `json:"conversation"`
+	Historical   bool   `json:"historical"`
+}
+
 type MessageAttachment struct {
 	File     []byte
 	Filename string
+	MediaID  string
 }
 
 func (ma *MessageAttachment) IsEmpty() bool {
 	return len(ma.File) == 0
 }
+
+type MarkReadRequest struct {
+	Chat   string   `json:"chat"`
+	Sender string   `json:"sender"`
+	IDs    []string `json:"ids"`
+}
+
+type ExportedMessage struct {
+	ID        string `json:"id"`
+	Chat      string `json:"chat"`
+	Sender    string `json:"sender"`
+	PushName  string `json:"pushName,omitempty"`
+	IsFromMe  bool   `json:"isFromMe"`
+	IsGroup   bool   `json:"isGroup"`
+	Timestamp string `json:"timestamp"`
+	MediaType string `json:"mediaType,omitempty"`
+	Text      string `json:"text,omitempty"`
+}
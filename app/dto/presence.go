@@ -0,0 +1,22 @@
+package dto
+
+type PresenceRequest struct {
+	State string `json:"state"`
+}
+
+type ChatPresenceRequest struct {
+	JID   string `json:"jid"`
+	State string `json:"state"`
+}
+
+// PresenceEvent is forwarded to PROXY_URL for subscribed contacts going
+// online/offline ("presence") and for typing or recording in a chat
+// ("chat_presence").
+type PresenceEvent struct {
+	Event     string `json:"event"`
+	JID       string `json:"jid"`
+	Chat      string `json:"chat"`
+	State     string `json:"state"`
+	LastSeen  string `json:"lastSeen"`
+	Timestamp string `json:"timestamp"`
+}
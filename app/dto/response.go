@@ -1,5 +1,6 @@
 package dto
 
 type Response struct {
-	Status bool `json:"status"`
+	Status bool   `json:"status"`
+	Error  string `json:"error,omitempty"`
 }
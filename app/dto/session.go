@@ -0,0 +1,26 @@
+package dto
+
+type SessionStatus struct {
+	LoggedIn  bool   `json:"loggedIn"`
+	Connected bool   `json:"connected"`
+	JID       string `json:"jid,omitempty"`
+	PushName  string `json:"pushName,omitempty"`
+	Platform  string `json:"platform,omitempty"`
+	// History is the progress of the history sync, once one started.
+	History *HistorySyncStatus `json:"history,omitempty"`
+}
+
+// HistorySyncStatus counts what the history sync after pairing delivered so
+// far. Progress is the percentage WhatsApp reports for the full sync.
+type HistorySyncStatus struct {
+	SyncType      string `json:"syncType"`
+	Progress      uint32 `json:"progress"`
+	Chunks        int    `json:"chunks"`
+	Conversations int    `json:"conversations"`
+	Messages      int    `json:"messages"`
+	Failed        int    `json:"failed"`
+	// WebhookDropped counts the messages not posted to HISTORY_PROXY_URL
+	// because it fell too far behind.
+	WebhookDropped int    `json:"webhookDropped"`
+	LastChunk      string `json:"lastChunk"`
+}
@@ -0,0 +1,11 @@
+package dto
+
+type GroupSettings struct {
+	Mode       string   `json:"mode"`
+	Allowlist  []string `json:"allowlist"`
+	Structured bool     `json:"structured"`
+}
+
+type ReadSettings struct {
+	Policy string `json:"policy"`
+}
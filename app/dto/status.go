@@ -0,0 +1,32 @@
+package dto
+
+// StatusUpdate is a contact's status (story) post, forwarded to
+// STATUS_PROXY_URL instead of the regular webhook.
+type StatusUpdate struct {
+	Event      string `json:"event"`
+	ID         string `json:"id"`
+	Sender     string `json:"sender"`
+	SenderName string `json:"senderName"`
+	IsFromMe   bool   `json:"isFromMe"`
+	Timestamp  string `json:"timestamp"`
+	MediaType  string `json:"mediaType"`
+	Text       string `json:"text"`
+	Caption    string `json:"caption"`
+	MediaURL   string `json:"mediaUrl"`
+}
+
+type StatusRequest struct {
+	Message         string `json:"message"`
+	Media           string `json:"media"`
+	BackgroundColor string `json:"backgroundColor"`
+	TextColor       string `json:"textColor"`
+	Font            int32  `json:"font"`
+	// Recipients is a per-post audience. It is rejected for now, statuses
+	// always go to the audience of the phone's status privacy settings.
+	Recipients []string `json:"recipients"`
+}
+
+type StatusResponse struct {
+	Status bool   `json:"status"`
+	ID     string `json:"id"`
+}
@@ -0,0 +1,169 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// Formats of the log output.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var (
+	level  = new(slog.LevelVar)
+	redact atomic.Bool
+)
+
+// phoneNumber matches the user part of JIDs and other long digit runs.
+var phoneNumber = regexp.MustCompile(`\+?\d{7,}`)
+
+// phoneKeys are attributes holding JIDs or phone numbers.
+var phoneKeys = map[string]bool{
+	"chat":     true,
+	"sender":   true,
+	"receiver": true,
+	"jid":      true,
+	"phone":    true,
+}
+
+// contentKeys are attributes holding message content.
+var contentKeys = map[string]bool{
+	"body":    true,
+	"text":    true,
+	"caption": true,
+}
+
+func init() {
+	redact.Store(true)
+}
+
+// Setup installs the default logger writing to out in the given format. The
+// standard log package is routed through it as well.
+func Setup(out io.Writer, format string) {
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceAttr}
+
+	var handler slog.Handler
+	if format == FormatJSON {
+		handler = slog.NewJSONHandler(out, options)
+	} else {
+		handler = slog.NewTextHandler(out, options)
+	}
+
+	slog.SetDefault(slog.New(handler))
+}
+
+// Configure sets the level (DEBUG, INFO, WARN or ERROR, empty for DEBUG) and
+// whether message bodies and phone numbers are redacted. It takes effect
+// immediately, for a configuration reload.
+func Configure(levelName string, redactSensitive bool) {
+	switch strings.ToUpper(levelName) {
+	case "INFO":
+		level.Set(slog.LevelInfo)
+	case "WARN":
+		level.Set(slog.LevelWarn)
+	case "ERROR":
+		level.Set(slog.LevelError)
+	default:
+		level.Set(slog.LevelDebug)
+	}
+
+	redact.Store(redactSensitive)
+}
+
+func replaceAttr(groups []string, attr slog.Attr) slog.Attr {
+	if !redact.Load() {
+		return attr
+	}
+
+	switch {
+	case attr.Key == slog.MessageKey && attr.Value.Kind() == slog.KindString:
+		return slog.String(attr.Key, MaskPhones(attr.Value.String()))
+	case contentKeys[attr.Key]:
+		return slog.String(attr.Key, fmt.Sprintf("[redacted %d chars]", utf8.RuneCountInString(attr.Value.String())))
+	case phoneKeys[attr.Key]:
+		return slog.String(attr.Key, MaskPhones(attr.Value.String()))
+	}
+
+	return attr
+}
+
+// MaskPhones keeps the first two and last two digits of phone numbers in s.
+func MaskPhones(s string) string {
+	return phoneNumber.ReplaceAllStringFunc(s, func(number string) string {
+		return number[:2] + strings.Repeat("*", len(number)-4) + number[len(number)-2:]
+	})
+}
+
+type contextKey struct{}
+
+// WithRequestID returns a context whose logger tags entries with the request
+// ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return NewContext(ctx, slog.Default().With("request_id", id))
+}
+
+// NewContext returns a context carrying logger, e.g. one tagged with the
+// message being processed.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger of the context, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+
+	return slog.Default()
+}
+
+// WA adapts the default logger to whatsmeow's logger, tagging entries with
+// the module.
+func WA(module string) waLog.Logger {
+	return &waLogger{module: module}
+}
+
+type waLogger struct {
+	module string
+}
+
+func (l *waLogger) log(lvl slog.Level, msg string, args []interface{}) {
+	logger := slog.Default()
+	if !logger.Enabled(context.Background(), lvl) {
+		return
+	}
+
+	logger.Log(context.Background(), lvl, fmt.Sprintf(msg, args...), "module", l.module)
+}
+
+func (l *waLogger) Warnf(msg string, args ...interface{}) {
+	l.log(slog.LevelWarn, msg, args)
+}
+
+func (l *waLogger) Errorf(msg string, args ...interface{}) {
+	l.log(slog.LevelError, msg, args)
+}
+
+func (l *waLogger) Infof(msg string, args ...interface{}) {
+	l.log(slog.LevelInfo, msg, args)
+}
+
+func (l *waLogger) Debugf(msg string, args ...interface{}) {
+	l.log(slog.LevelDebug, msg, args)
+}
+
+func (l *waLogger) Sub(module string) waLog.Logger {
+	return &waLogger{module: l.module + "/" + module}
+}
@@ -0,0 +1,160 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// isOggOpus reports whether data is an Ogg stream with Opus audio, the only
+// format WhatsApp plays as a voice note.
+func isOggOpus(data []byte) bool {
+	return len(data) >= 47 && bytes.HasPrefix(data, []byte("OggS")) && string(data[28:36]) == "OpusHead"
+}
+
+// oggOpusDuration reads the duration from the granule position of the last
+// Ogg page, Opus always counts 48 kHz samples.
+func oggOpusDuration(data []byte) (uint32, bool) {
+	if !isOggOpus(data) {
+		return 0, false
+	}
+
+	preSkip := uint64(binary.LittleEndian.Uint16(data[38:40]))
+
+	last := bytes.LastIndex(data, []byte("OggS"))
+	if last < 0 || last+14 > len(data) {
+		return 0, false
+	}
+
+	granule := binary.LittleEndian.Uint64(data[last+6 : last+14])
+	if granule <= preSkip {
+		return 0, false
+	}
+
+	return uint32((granule - preSkip + 24000) / 48000), true
+}
+
+var (
+	mp3Bitrates = [2][16]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	}
+	mp3SampleRates = [4][3]int{
+		{11025, 12000, 8000},  // MPEG 2.5
+		{0, 0, 0},             // reserved
+		{22050, 24000, 16000}, // MPEG 2
+		{44100, 48000, 32000}, // MPEG 1
+	}
+)
+
+// mp3Duration adds up the MPEG layer III frames, which also works for
+// variable bitrate files without a Xing header.
+func mp3Duration(data []byte) (uint32, bool) {
+	i := 0
+	if len(data) >= 10 && bytes.HasPrefix(data, []byte("ID3")) {
+		size := int(data[6]&0x7F)<<21 | int(data[7]&0x7F)<<14 | int(data[8]&0x7F)<<7 | int(data[9]&0x7F)
+		i = 10 + size
+		if data[5]&0x10 != 0 {
+			i += 10
+		}
+	}
+
+	var seconds float64
+	frames := 0
+	for i+4 <= len(data) {
+		h := data[i : i+4]
+		if h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+			i++
+			continue
+		}
+
+		version := (h[1] >> 3) & 3
+		layer := (h[1] >> 1) & 3
+		bitrateIndex := h[2] >> 4
+		rateIndex := (h[2] >> 2) & 3
+		padding := int((h[2] >> 1) & 1)
+		if version == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+			i++
+			continue
+		}
+
+		table, samplesPerFrame := 0, 1152
+		if version != 3 {
+			table, samplesPerFrame = 1, 576
+		}
+		bitrate := mp3Bitrates[table][bitrateIndex] * 1000
+		sampleRate := mp3SampleRates[version][rateIndex]
+
+		frameLength := samplesPerFrame/8*bitrate/sampleRate + padding
+		if frameLength < 4 {
+			i++
+			continue
+		}
+
+		seconds += float64(samplesPerFrame) / float64(sampleRate)
+		frames++
+		i += frameLength
+	}
+
+	if frames == 0 {
+		return 0, false
+	}
+
+	return uint32(seconds + 0.5), true
+}
+
+// mp4Duration reads the duration from the movie header (moov/mvhd) box.
+func mp4Duration(data []byte) (uint32, bool) {
+	moov, ok := findBox(data, "moov")
+	if !ok {
+		return 0, false
+	}
+	mvhd, ok := findBox(moov, "mvhd")
+	if !ok || len(mvhd) < 20 {
+		return 0, false
+	}
+
+	var timescale, duration uint64
+	if mvhd[0] == 1 {
+		if len(mvhd) < 32 {
+			return 0, false
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+	if timescale == 0 {
+		return 0, false
+	}
+
+	return uint32((duration + timescale/2) / timescale), true
+}
+
+// findBox returns the payload of the first ISO BMFF box of the given type
+// found directly in data.
+func findBox(data []byte, boxType string) ([]byte, bool) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, false
+			}
+			size, header = binary.BigEndian.Uint64(data[8:16]), 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return nil, false
+		}
+
+		if string(data[4:8]) == boxType {
+			return data[header:size], true
+		}
+		data = data[size:]
+	}
+
+	return nil, false
+}
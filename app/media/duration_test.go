@@ -0,0 +1,145 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// oggOpus builds an Ogg Opus stream from the OpusHead page and a last page
+// with the given granule position.
+func oggOpus(preSkip uint16, granule uint64) []byte {
+	head := make([]byte, 47)
+	copy(head, "OggS")
+	copy(head[28:], "OpusHead")
+	head[36] = 1 // version
+	head[37] = 1 // channels
+	binary.LittleEndian.PutUint16(head[38:40], preSkip)
+
+	last := make([]byte, 27)
+	copy(last, "OggS")
+	binary.LittleEndian.PutUint64(last[6:14], granule)
+
+	return append(head, last...)
+}
+
+func TestOggOpusDuration(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		want   uint32
+		wantOK bool
+	}{
+		{"ten seconds", oggOpus(312, 312+10*48000), 10, true},
+		{"rounds half up", oggOpus(0, 48000+24000), 2, true},
+		{"under half a second", oggOpus(0, 1000), 0, true},
+		{"granule within pre-skip", oggOpus(312, 100), 0, false},
+		{"not opus", append([]byte("OggS"), make([]byte, 60)...), 0, false},
+		{"too short", []byte("OggS"), 0, false},
+		{"empty", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := oggOpusDuration(tt.data)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("oggOpusDuration() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// mp3Frames builds MPEG 1 layer III frames at 128 kbps and 44.1 kHz, which
+// are 417 bytes and 1152 samples long.
+func mp3Frames(n int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+
+	return bytes.Repeat(frame, n)
+}
+
+func TestMP3Duration(t *testing.T) {
+	id3 := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x0A"), make([]byte, 10)...)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		want   uint32
+		wantOK bool
+	}{
+		{"ten seconds", mp3Frames(383), 10, true},
+		{"with id3 tag", append(id3, mp3Frames(383)...), 10, true},
+		{"garbage before the first frame", append([]byte{0x00, 0x12, 0xFF}, mp3Frames(383)...), 10, true},
+		{"one frame", mp3Frames(1), 0, true},
+		{"no frames", make([]byte, 1000), 0, false},
+		{"free bitrate", []byte{0xFF, 0xFB, 0x00, 0x00}, 0, false},
+		{"empty", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := mp3Duration(tt.data)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("mp3Duration() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func box(boxType string, payload ...[]byte) []byte {
+	content := bytes.Join(payload, nil)
+	b := make([]byte, 8, 8+len(content))
+	binary.BigEndian.PutUint32(b, uint32(8+len(content)))
+	copy(b[4:], boxType)
+
+	return append(b, content...)
+}
+
+func mvhd(version byte, timescale uint32, duration uint64) []byte {
+	if version == 1 {
+		payload := make([]byte, 32)
+		payload[0] = 1
+		binary.BigEndian.PutUint32(payload[20:24], timescale)
+		binary.BigEndian.PutUint64(payload[24:32], duration)
+		return box("mvhd", payload)
+	}
+
+	payload := make([]byte, 20)
+	binary.BigEndian.PutUint32(payload[12:16], timescale)
+	binary.BigEndian.PutUint32(payload[16:20], uint32(duration))
+	return box("mvhd", payload)
+}
+
+func TestMP4Duration(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom\x00\x00\x02\x00"))
+
+	largeMoov := box("moov", mvhd(0, 1000, 5000))
+	largeMoov = append([]byte{0, 0, 0, 1, 'm', 'o', 'o', 'v', 0, 0, 0, 0, 0, 0, 0, 0}, largeMoov[8:]...)
+	binary.BigEndian.PutUint64(largeMoov[8:16], uint64(len(largeMoov)))
+
+	tests := []struct {
+		name   string
+		data   []byte
+		want   uint32
+		wantOK bool
+	}{
+		{"version 0", append(ftyp, box("moov", mvhd(0, 1000, 65500))...), 66, true},
+		{"version 1", append(ftyp, box("moov", mvhd(1, 90000, 90000*30))...), 30, true},
+		{"moov after mdat", append(box("mdat", make([]byte, 100)), box("moov", mvhd(0, 600, 6000))...), 10, true},
+		{"64-bit box size", largeMoov, 5, true},
+		{"zero timescale", box("moov", mvhd(0, 0, 100)), 0, false},
+		{"no mvhd", box("moov", box("trak")), 0, false},
+		{"no moov", ftyp, 0, false},
+		{"truncated box", box("moov", mvhd(0, 1000, 5000))[:20], 0, false},
+		{"empty", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := mp4Duration(tt.data)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("mp4Duration() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const maxRedirects = 5
+
+var (
+	ErrHostNotAllowed = errors.New("host is not allowed")
+	ErrPrivateAddress = errors.New("address is in a private network")
+)
+
+type FetcherConfig struct {
+	Timeout time.Duration
+	MaxSize int64
+	// AllowHosts restricts fetching to these hosts when not empty, DenyHosts
+	// is checked first. "*.example.com" matches any subdomain.
+	AllowHosts []string
+	DenyHosts  []string
+	// AllowPrivate permits loopback, private and link-local addresses, which
+	// are blocked by default so URLs can't reach internal services.
+	AllowPrivate bool
+	// Headers are added to requests by host, e.g. credentials for a private
+	// CDN. They're never sent to other hosts, including after redirects.
+	Headers map[string]map[string]string
+}
+
+// Fetcher downloads outgoing media from URLs given by API clients.
+type Fetcher struct {
+	cfg    FetcherConfig
+	client *http.Client
+}
+
+func NewFetcher(cfg FetcherConfig) *Fetcher {
+	f := &Fetcher{cfg: cfg}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !cfg.AllowPrivate {
+		// Checking the address being connected to, rather than what the host
+		// name resolved to earlier, also covers DNS rebinding.
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+			}
+			return nil
+		}
+	}
+
+	f.client = &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			// No environment proxies, they would bypass the address check.
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: cfg.Timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if err := f.checkURL(req.URL); err != nil {
+				return err
+			}
+			for _, headers := range f.cfg.Headers {
+				for name := range headers {
+					req.Header.Del(name)
+				}
+			}
+			f.addHeaders(req)
+			return nil
+		},
+	}
+
+	return f
+}
+
+// Fetch downloads the URL, failing on anything but 200 and on bodies larger
+// than the configured maximum.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	f.addHeaders(req)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", u.Redacted(), resp.Status)
+	}
+	if f.cfg.MaxSize > 0 && resp.ContentLength > f.cfg.MaxSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTooLarge, resp.ContentLength)
+	}
+
+	body := io.Reader(resp.Body)
+	if f.cfg.MaxSize > 0 {
+		body = io.LimitReader(resp.Body, f.cfg.MaxSize+1)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if f.cfg.MaxSize > 0 && int64(len(data)) > f.cfg.MaxSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, f.cfg.MaxSize)
+	}
+
+	return data, nil
+}
+
+func (f *Fetcher) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("only http and https urls can be fetched")
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return errors.New("url has no host")
+	}
+
+	for _, pattern := range f.cfg.DenyHosts {
+		if hostMatches(pattern, host) {
+			return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+		}
+	}
+
+	if len(f.cfg.AllowHosts) > 0 {
+		for _, pattern := range f.cfg.AllowHosts {
+			if hostMatches(pattern, host) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+
+	return nil
+}
+
+func (f *Fetcher) addHeaders(req *http.Request) {
+	host := strings.ToLower(req.URL.Hostname())
+	for pattern, headers := range f.cfg.Headers {
+		if hostMatches(pattern, host) {
+			for name, value := range headers {
+				req.Header.Set(name, value)
+			}
+		}
+	}
+}
+
+func hostMatches(pattern, host string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if suffix := strings.TrimPrefix(pattern, "*"); strings.HasPrefix(suffix, ".") {
+		return strings.HasSuffix(host, suffix)
+	}
+
+	return pattern == host
+}
+
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || cgnat.Contains(ip)
+}
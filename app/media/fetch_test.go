@@ -0,0 +1,150 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHostMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		host    string
+		want    bool
+	}{
+		{"cdn.example.com", "cdn.example.com", true},
+		{"CDN.Example.com ", "cdn.example.com", true},
+		{"cdn.example.com", "example.com", false},
+		{"cdn.example.com", "evilcdn.example.com", false},
+		{"*.example.com", "cdn.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "evilexample.com", false},
+		{".example.com", "cdn.example.com", true},
+		{"example.com", "example.com.evil.net", false},
+		{"*", "example.com", false},
+		{"", "example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.host, func(t *testing.T) {
+			if got := hostMatches(tt.pattern, tt.host); got != tt.want {
+				t.Errorf("hostMatches(%q, %q) = %v, want %v", tt.pattern, tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"127.255.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"192.168.1.1", true},
+		{"100.64.0.1", true},
+		{"100.127.255.255", true},
+		{"169.254.169.254", true},
+		{"0.0.0.0", true},
+		{"224.0.0.1", true},
+		{"::1", true},
+		{"::", true},
+		{"fe80::1", true},
+		{"fc00::1", true},
+		{"fd12:3456::1", true},
+		{"ff02::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"::ffff:100.64.0.1", true},
+		{"8.8.8.8", false},
+		{"172.32.0.1", false},
+		{"100.128.0.1", false},
+		{"157.240.1.1", false},
+		{"2a03:2880::1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := isPrivateIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("isPrivateIP(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchBlocksPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	f := NewFetcher(FetcherConfig{Timeout: 5 * time.Second})
+	if _, err := f.Fetch(context.Background(), server.URL); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Fetch(%s) error = %v, want %v", server.URL, err, ErrPrivateAddress)
+	}
+}
+
+func TestFetchRedirectDropsHeaders(t *testing.T) {
+	var gotAuth string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte("media"))
+	}))
+	defer target.Close()
+
+	// The same server under another host name, so the headers configured
+	// for the first host don't apply.
+	targetURL, _ := url.Parse(target.URL)
+	targetURL.Host = net.JoinHostPort("localhost", targetURL.Port())
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("origin got Authorization %q, want the configured one", r.Header.Get("Authorization"))
+		}
+		http.Redirect(w, r, targetURL.String(), http.StatusFound)
+	}))
+	defer origin.Close()
+
+	f := NewFetcher(FetcherConfig{
+		Timeout:      5 * time.Second,
+		AllowPrivate: true,
+		Headers:      map[string]map[string]string{"127.0.0.1": {"Authorization": "Bearer secret"}},
+	})
+
+	data, err := f.Fetch(context.Background(), origin.URL)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if string(data) != "media" {
+		t.Errorf("Fetch = %q, want %q", data, "media")
+	}
+	if gotAuth != "" {
+		t.Errorf("redirect target got Authorization %q, want none", gotAuth)
+	}
+}
+
+func TestFetchRedirectToDeniedHost(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://metadata.internal/latest", http.StatusFound)
+	}))
+	defer origin.Close()
+
+	f := NewFetcher(FetcherConfig{
+		Timeout:      5 * time.Second,
+		AllowPrivate: true,
+		DenyHosts:    []string{"*.internal"},
+	})
+
+	if _, err := f.Fetch(context.Background(), origin.URL); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("Fetch error = %v, want %v", err, ErrHostNotAllowed)
+	}
+}
@@ -0,0 +1,64 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const ffmpegTimeout = 2 * time.Minute
+
+// ErrNoFFmpeg is returned when FFMPEG_PATH is set but isn't an ffmpeg binary
+// that can be run. Go has no video decoder or Opus encoder of its own, so
+// transcoding and video thumbnails need ffmpeg.
+var ErrNoFFmpeg = errors.New("ffmpeg not found, check FFMPEG_PATH")
+
+// runFFmpeg feeds data to ffmpeg through a temporary file, as MP4 input with
+// the index at the end can't be read from a pipe, and returns its stdout.
+func runFFmpeg(ffmpeg string, data []byte, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(ffmpeg); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoFFmpeg, err)
+	}
+
+	input, err := os.CreateTemp("", "media-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(input.Name())
+
+	if _, err := input.Write(data); err != nil {
+		input.Close()
+		return nil, err
+	}
+	if err := input.Close(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ffmpegTimeout)
+	defer cancel()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, ffmpeg, append([]string{"-hide_banner", "-loglevel", "error", "-i", input.Name()}, args...)...)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// transcodeOpus converts any audio to mono Ogg Opus for voice notes.
+func transcodeOpus(ffmpeg string, data []byte) ([]byte, error) {
+	return runFFmpeg(ffmpeg, data, "-vn", "-c:a", "libopus", "-b:a", "32k", "-ac", "1", "-ar", "48000", "-f", "ogg", "pipe:1")
+}
+
+// videoThumbnail grabs the first frame of a video as a thumbnail sized JPEG.
+func videoThumbnail(ffmpeg string, data []byte) ([]byte, error) {
+	scale := "scale='if(gt(iw,ih)," + strconv.Itoa(thumbnailSize) + ",-2)':'if(gt(iw,ih),-2," + strconv.Itoa(thumbnailSize) + ")'"
+	return runFFmpeg(ffmpeg, data, "-frames:v", "1", "-vf", scale, "-f", "image2", "-c:v", "mjpeg", "pipe:1")
+}
@@ -0,0 +1,23 @@
+package media
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPrepareVideoFFmpeg(t *testing.T) {
+	video := append(box("ftyp", []byte("isom\x00\x00\x02\x00isommp41")), box("moov", mvhd(0, 1000, 3000))...)
+
+	prepared, err := Prepare(video, Options{})
+	if err != nil {
+		t.Fatalf("Prepare without ffmpeg: %v", err)
+	}
+	if prepared.Kind != KindVideo || prepared.Seconds != 3 || prepared.Thumbnail != nil {
+		t.Errorf("Prepare without ffmpeg = %s, %d s, %d byte thumbnail, want a video of 3 s without thumbnail",
+			prepared.Kind, prepared.Seconds, len(prepared.Thumbnail))
+	}
+
+	if _, err := Prepare(video, Options{FFmpeg: "/nonexistent/ffmpeg"}); !errors.Is(err, ErrNoFFmpeg) {
+		t.Errorf("Prepare with a missing ffmpeg error = %v, want %v", err, ErrNoFFmpeg)
+	}
+}
@@ -0,0 +1,111 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// thumbnailSize is the longest side of the JPEG previews WhatsApp shows
+// while the actual image or video is loading.
+const thumbnailSize = 72
+
+// maxPixels bounds the dimensions of decoded images. A small file can declare
+// huge dimensions, and decoding allocates memory for all of its pixels.
+const maxPixels = 50_000_000
+
+var ErrUnsupportedImage = errors.New("unsupported image format")
+
+// decodeImage checks the declared dimensions before decoding the image.
+func decodeImage(data []byte) (image.Image, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedImage
+	}
+	if pixels := int64(config.Width) * int64(config.Height); pixels > maxPixels {
+		return nil, "", fmt.Errorf("%w: image of %dx%d pixels exceeds %d pixels", ErrTooLarge, config.Width, config.Height, maxPixels)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedImage
+	}
+
+	return img, format, nil
+}
+
+// ToJPEG re-encodes any supported image as JPEG, JPEGs are returned as is.
+// Only the first frame of animated images is kept.
+func ToJPEG(data []byte) ([]byte, error) {
+	img, format, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	if format == "jpeg" {
+		return data, nil
+	}
+
+	return encodeJPEG(img, 90)
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// thumbnail scales img down to thumbnailSize with a sampled box filter and
+// encodes it as JPEG.
+func thumbnail(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil, ErrUnsupportedImage
+	}
+
+	tw, th := width, height
+	if tw > thumbnailSize || th > thumbnailSize {
+		if width >= height {
+			tw, th = thumbnailSize, height*thumbnailSize/width
+		} else {
+			tw, th = width*thumbnailSize/height, thumbnailSize
+		}
+	}
+	if tw == 0 {
+		tw = 1
+	}
+	if th == 0 {
+		th = 1
+	}
+
+	// Average at most 4x4 samples per target pixel, which is plenty for a
+	// preview and keeps large photos fast.
+	const samples = 4
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		for x := 0; x < tw; x++ {
+			var r, g, b, n uint64
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					px := bounds.Min.X + (x*samples+sx)*width/(tw*samples)
+					py := bounds.Min.Y + (y*samples+sy)*height/(th*samples)
+					cr, cg, cb, _ := img.At(px, py).RGBA()
+					r, g, b, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: 0xFFFF})
+		}
+	}
+
+	return encodeJPEG(dst, 75)
+}
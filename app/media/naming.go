@@ -0,0 +1,158 @@
+package media
+
+import (
+	"encoding/hex"
+	"mime"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Kinds of received media, as far as naming is concerned.
+const (
+	NameImage    = "image"
+	NameVideo    = "video"
+	NameGIF      = "gif"
+	NamePTV      = "ptv"
+	NameAudio    = "audio"
+	NamePTT      = "ptt"
+	NameSticker  = "sticker"
+	NameDocument = "document"
+	NameVCard    = "vcard"
+	NameProduct  = "product"
+)
+
+const maxNameLength = 200
+
+// extensions maps the MIME types WhatsApp uses to the usual extension, the
+// standard library's table has several candidates for most of them.
+var extensions = map[string]string{
+	"image/jpeg":       "jpg",
+	"image/png":        "png",
+	"image/webp":       "webp",
+	"image/gif":        "gif",
+	"video/mp4":        "mp4",
+	"video/3gpp":       "3gp",
+	"video/quicktime":  "mov",
+	"audio/ogg":        "ogg",
+	"audio/opus":       "opus",
+	"audio/mpeg":       "mp3",
+	"audio/mp4":        "m4a",
+	"audio/aac":        "aac",
+	"audio/amr":        "amr",
+	"audio/wav":        "wav",
+	"text/vcard":       "vcf",
+	"text/x-vcard":     "vcf",
+	"text/plain":       "txt",
+	"application/pdf":  "pdf",
+	"application/zip":  "zip",
+	"application/json": "json",
+}
+
+// defaultExtensions are used when the MIME type is missing or unknown.
+var defaultExtensions = map[string]string{
+	NameImage:   "jpg",
+	NameVideo:   "mp4",
+	NameGIF:     "mp4",
+	NamePTV:     "mp4",
+	NameAudio:   "ogg",
+	NamePTT:     "ogg",
+	NameSticker: "webp",
+	NameVCard:   "vcf",
+	NameProduct: "jpg",
+}
+
+// FileInfo describes a received attachment for naming.
+type FileInfo struct {
+	Kind     string
+	MimeType string
+	// Name is the sender's file name for documents and the display name for
+	// contact cards, other kinds ignore it.
+	Name   string
+	SHA256 []byte
+}
+
+// Filename names an attachment. Documents and contact cards keep their
+// (sanitized) original name, everything else is named by content hash, so
+// the same file always gets the same name.
+func Filename(info FileInfo) string {
+	ext := Extension(info.MimeType)
+	if ext == "" {
+		ext = defaultExtensions[info.Kind]
+	}
+
+	switch info.Kind {
+	case NameDocument, NameVCard:
+		if name := SanitizeName(info.Name); name != "" {
+			if filepath.Ext(name) == "" && ext != "" {
+				name += "." + ext
+			}
+			return name
+		}
+	}
+
+	name := "file"
+	if len(info.SHA256) > 0 {
+		name = hex.EncodeToString(info.SHA256)
+	}
+	if ext == "" {
+		ext = "bin"
+	}
+
+	return name + "." + ext
+}
+
+// Extension returns the extension for a MIME type, without the dot. MIME
+// parameters such as "; codecs=opus" are ignored.
+func Extension(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return ""
+	}
+
+	if ext, ok := extensions[mediaType]; ok {
+		return ext
+	}
+
+	candidates, err := mime.ExtensionsByType(mediaType)
+	if err != nil || len(candidates) == 0 {
+		return ""
+	}
+	sort.Strings(candidates)
+
+	return strings.TrimPrefix(candidates[0], ".")
+}
+
+// SanitizeName makes a name from a message safe to use as a file name: any
+// directories are stripped (with / or \ separators), control characters are
+// dropped and the length is limited, keeping the extension.
+func SanitizeName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	name = strings.TrimLeft(name, ".")
+
+	if len(name) > maxNameLength {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		base := []rune(strings.TrimSuffix(name, ext))
+		for len(string(base))+len(ext) > maxNameLength {
+			base = base[:len(base)-1]
+		}
+		name = string(base) + ext
+	}
+
+	return name
+}
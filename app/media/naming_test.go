@@ -0,0 +1,131 @@
+package media
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilename(t *testing.T) {
+	hash := []byte{0xde, 0xad, 0xbe, 0xef}
+
+	tests := []struct {
+		name string
+		info FileInfo
+		want string
+	}{
+		{"image by hash", FileInfo{Kind: NameImage, MimeType: "image/jpeg", SHA256: hash}, "deadbeef.jpg"},
+		{"image without mimetype", FileInfo{Kind: NameImage, SHA256: hash}, "deadbeef.jpg"},
+		{"gif playback", FileInfo{Kind: NameGIF, MimeType: "video/mp4", SHA256: hash}, "deadbeef.mp4"},
+		{"ptv", FileInfo{Kind: NamePTV, MimeType: "video/mp4", SHA256: hash}, "deadbeef.mp4"},
+		{"ptv without mimetype", FileInfo{Kind: NamePTV, SHA256: hash}, "deadbeef.mp4"},
+		{"ptt with codecs", FileInfo{Kind: NamePTT, MimeType: "audio/ogg; codecs=opus", SHA256: hash}, "deadbeef.ogg"},
+		{"sticker", FileInfo{Kind: NameSticker, MimeType: "image/webp", SHA256: hash}, "deadbeef.webp"},
+		{"sticker without mimetype", FileInfo{Kind: NameSticker, SHA256: hash}, "deadbeef.webp"},
+		{"image ignores name", FileInfo{Kind: NameImage, MimeType: "image/png", Name: "photo.png", SHA256: hash}, "deadbeef.png"},
+		{"no hash", FileInfo{Kind: NameImage, MimeType: "image/jpeg"}, "file.jpg"},
+		{"unknown kind and mimetype", FileInfo{Kind: "other", SHA256: hash}, "deadbeef.bin"},
+		{"document keeps name", FileInfo{Kind: NameDocument, MimeType: "application/pdf", Name: "report.pdf", SHA256: hash}, "report.pdf"},
+		{"document gets extension", FileInfo{Kind: NameDocument, MimeType: "application/pdf", Name: "report", SHA256: hash}, "report.pdf"},
+		{"document with path traversal", FileInfo{Kind: NameDocument, MimeType: "application/pdf", Name: "../../etc/passwd", SHA256: hash}, "passwd.pdf"},
+		{"document with backslashes", FileInfo{Kind: NameDocument, MimeType: "text/plain", Name: `..\..\boot.ini`, SHA256: hash}, "boot.ini"},
+		{"document without mimetype", FileInfo{Kind: NameDocument, Name: "notes", SHA256: hash}, "notes"},
+		{"document without name", FileInfo{Kind: NameDocument, MimeType: "application/pdf", SHA256: hash}, "deadbeef.pdf"},
+		{"document named only dots", FileInfo{Kind: NameDocument, MimeType: "application/zip", Name: "../..", SHA256: hash}, "deadbeef.zip"},
+		{"vcard", FileInfo{Kind: NameVCard, MimeType: "text/vcard", Name: "Jane Doe"}, "Jane Doe.vcf"},
+		{"vcard without name", FileInfo{Kind: NameVCard, MimeType: "text/vcard"}, "file.vcf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Filename(tt.info); got != tt.want {
+				t.Errorf("Filename(%+v) = %q, want %q", tt.info, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilenameIsStable(t *testing.T) {
+	info := FileInfo{Kind: NameVideo, MimeType: "video/mp4", SHA256: []byte{1, 2, 3}}
+
+	first := Filename(info)
+	for i := 0; i < 3; i++ {
+		if got := Filename(info); got != first {
+			t.Fatalf("Filename changed from %q to %q", first, got)
+		}
+	}
+	if first != "010203.mp4" {
+		t.Errorf("Filename = %q, want %q", first, "010203.mp4")
+	}
+}
+
+func TestExtension(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		want     string
+	}{
+		{"image/jpeg", "jpg"},
+		{"image/webp", "webp"},
+		{"video/3gpp", "3gp"},
+		{"audio/ogg; codecs=opus", "ogg"},
+		{"audio/mpeg", "mp3"},
+		{"text/x-vcard", "vcf"},
+		{"application/pdf", "pdf"},
+		{"", ""},
+		{"not a mimetype", ""},
+		{"application/x-unknown-to-everyone", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mimeType, func(t *testing.T) {
+			if got := Extension(tt.mimeType); got != tt.want {
+				t.Errorf("Extension(%q) = %q, want %q", tt.mimeType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	long := strings.Repeat("a", 300)
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain", "invoice.pdf", "invoice.pdf"},
+		{"relative path", "../../etc/passwd", "passwd"},
+		{"absolute path", "/var/lib/file.txt", "file.txt"},
+		{"windows path", `C:\Users\x\doc.docx`, "doc.docx"},
+		{"mixed separators", `a/b\c/d.txt`, "d.txt"},
+		{"trailing separator", "dir/", ""},
+		{"hidden file", ".bashrc", "bashrc"},
+		{"dots only", "..", ""},
+		{"control characters", "in\x00vo\nice\t.pdf", "invoice.pdf"},
+		{"surrounding spaces", "  name.txt  ", "name.txt"},
+		{"unicode", "résumé ✓.pdf", "résumé ✓.pdf"},
+		{"long name keeps extension", long + ".pdf", strings.Repeat("a", maxNameLength-4) + ".pdf"},
+		{"long extension is cut", "x." + long, ("x." + long)[:maxNameLength]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeName(tt.input); got != tt.want {
+				t.Errorf("SanitizeName(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeNameKeepsRunesWhole(t *testing.T) {
+	name := SanitizeName(strings.Repeat("é", 150) + ".txt")
+
+	if len(name) > maxNameLength {
+		t.Errorf("len = %d, want at most %d", len(name), maxNameLength)
+	}
+	if !strings.HasSuffix(name, ".txt") {
+		t.Errorf("%q lost its extension", name)
+	}
+	if strings.ContainsRune(name, '\uFFFD') {
+		t.Errorf("%q contains a broken rune", name)
+	}
+}
@@ -0,0 +1,166 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+type Kind string
+
+const (
+	KindImage    Kind = "image"
+	KindVideo    Kind = "video"
+	KindAudio    Kind = "audio"
+	KindDocument Kind = "document"
+)
+
+// maxSizes are WhatsApp's limits for outgoing media.
+var maxSizes = map[Kind]int{
+	KindImage:    16 << 20,
+	KindVideo:    16 << 20,
+	KindAudio:    16 << 20,
+	KindDocument: 100 << 20,
+}
+
+var ErrTooLarge = errors.New("media is too large")
+
+type Options struct {
+	// PTT sends audio as a voice note. Voice notes must be Ogg Opus, other
+	// audio is transcoded when FFmpeg is set and rejected otherwise.
+	PTT bool
+	// FFmpeg is the path of the ffmpeg binary, used for transcoding audio
+	// and for video thumbnails, which can't be done in pure Go. Without it
+	// videos are sent with a blank preview.
+	FFmpeg string
+}
+
+// Prepared is outgoing media ready for upload, with the metadata WhatsApp
+// clients need to render it.
+type Prepared struct {
+	Kind      Kind
+	Data      []byte
+	MimeType  string
+	Thumbnail []byte
+	Width     uint32
+	Height    uint32
+	Seconds   uint32
+	PTT       bool
+}
+
+// Prepare decides how data is sent and validates it against the size limits.
+// Images get dimensions and a thumbnail, WebP and GIF images are converted to
+// JPEG since WhatsApp would otherwise only accept them as documents.
+func Prepare(data []byte, opts Options) (*Prepared, error) {
+	mtype := mimetype.Detect(data)
+	prepared := &Prepared{Data: data, MimeType: mtype.String()}
+
+	kind := KindDocument
+	switch {
+	case mtype.Is("image/jpeg"), mtype.Is("image/png"), mtype.Is("image/webp"), mtype.Is("image/gif"):
+		kind = KindImage
+	case mtype.Is("video/mp4"), mtype.Is("video/3gpp"):
+		kind = KindVideo
+	case strings.HasPrefix(prepared.MimeType, "audio/"):
+		kind = KindAudio
+	}
+
+	// Check the size before decoding or transcoding anything.
+	if limit := maxSizes[kind]; len(data) > limit {
+		return nil, fmt.Errorf("%w: %s of %d bytes exceeds %d bytes", ErrTooLarge, kind, len(data), limit)
+	}
+
+	switch kind {
+	case KindImage:
+		if err := prepareImage(prepared); err != nil {
+			return nil, err
+		}
+	case KindVideo:
+		if err := prepareVideo(prepared, opts); err != nil {
+			return nil, err
+		}
+	case KindAudio:
+		if err := prepareAudio(prepared, opts); err != nil {
+			return nil, err
+		}
+	default:
+		prepared.Kind = KindDocument
+	}
+
+	if limit := maxSizes[prepared.Kind]; len(prepared.Data) > limit {
+		return nil, fmt.Errorf("%w: %s of %d bytes exceeds %d bytes", ErrTooLarge, prepared.Kind, len(prepared.Data), limit)
+	}
+
+	return prepared, nil
+}
+
+func prepareImage(prepared *Prepared) error {
+	img, format, err := decodeImage(prepared.Data)
+	if errors.Is(err, ErrTooLarge) {
+		return err
+	} else if err != nil {
+		// Not decodable after all, let the recipient deal with it.
+		prepared.Kind = KindDocument
+		return nil
+	}
+
+	prepared.Kind = KindImage
+	if format != "jpeg" && format != "png" {
+		if prepared.Data, err = encodeJPEG(img, 90); err != nil {
+			return err
+		}
+		prepared.MimeType = "image/jpeg"
+	}
+
+	bounds := img.Bounds()
+	prepared.Width, prepared.Height = uint32(bounds.Dx()), uint32(bounds.Dy())
+	prepared.Thumbnail, err = thumbnail(img)
+
+	return err
+}
+
+func prepareVideo(prepared *Prepared, opts Options) error {
+	prepared.Kind = KindVideo
+	prepared.Seconds, _ = mp4Duration(prepared.Data)
+
+	if opts.FFmpeg == "" {
+		return nil
+	}
+
+	// A video ffmpeg can't read only gets a blank preview, but a missing
+	// ffmpeg is a configuration mistake.
+	thumbnail, err := videoThumbnail(opts.FFmpeg, prepared.Data)
+	if errors.Is(err, ErrNoFFmpeg) {
+		return err
+	}
+	prepared.Thumbnail = thumbnail
+
+	return nil
+}
+
+func prepareAudio(prepared *Prepared, opts Options) error {
+	prepared.Kind = KindAudio
+
+	if opts.PTT && !isOggOpus(prepared.Data) {
+		if opts.FFmpeg == "" {
+			return errors.New("voice notes must be ogg/opus, set FFMPEG_PATH to transcode other audio")
+		}
+		transcoded, err := transcodeOpus(opts.FFmpeg, prepared.Data)
+		if err != nil {
+			return err
+		}
+		prepared.Data = transcoded
+	}
+
+	if isOggOpus(prepared.Data) {
+		prepared.MimeType = "audio/ogg; codecs=opus"
+		prepared.Seconds, _ = oggOpusDuration(prepared.Data)
+		prepared.PTT = opts.PTT
+	} else if prepared.MimeType == "audio/mpeg" {
+		prepared.Seconds, _ = mp3Duration(prepared.Data)
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+var ErrInvalidID = errors.New("invalid media id")
+
+// Store keeps attachments on disk, named by the hex SHA256 of their content,
+// so every file is stored once no matter how often it's received or quoted.
+// When a quota is set the least recently stored files are evicted to stay
+// below it.
+type Store struct {
+	dir   string
+	quota int64
+	mu    sync.Mutex
+	// used is the size of the stored files, kept up to date by Save so the
+	// directory is only scanned when the quota is exceeded.
+	used int64
+}
+
+func NewStore(dir string, quota int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &Store{dir: dir, quota: quota}
+	if quota > 0 {
+		_, used, err := s.scan()
+		if err != nil {
+			return nil, err
+		}
+		s.used = used
+	}
+
+	return s, nil
+}
+
+// ID returns the media ID for a SHA256 checksum, or "" if it isn't one.
+func ID(sum []byte) string {
+	if len(sum) != sha256.Size {
+		return ""
+	}
+
+	return hex.EncodeToString(sum)
+}
+
+func validID(id string) bool {
+	if len(id) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id[:2], id)
+}
+
+func (s *Store) Has(id string) bool {
+	if !validID(id) {
+		return false
+	}
+
+	_, err := os.Stat(s.path(id))
+	return err == nil
+}
+
+func (s *Store) Read(id string) ([]byte, error) {
+	if !validID(id) {
+		return nil, ErrInvalidID
+	}
+
+	return os.ReadFile(s.path(id))
+}
+
+// Open returns the stored file for serving, the caller closes it.
+func (s *Store) Open(id string) (*os.File, error) {
+	if !validID(id) {
+		return nil, ErrInvalidID
+	}
+
+	return os.Open(s.path(id))
+}
+
+// Save stores data and returns its media ID.
+func (s *Store) Save(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:])
+	path := s.path(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := os.Stat(path); err == nil {
+		return id, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), id+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	s.used += int64(len(data))
+	if s.quota > 0 && s.used > s.quota {
+		if err := s.evict(id); err != nil {
+			return id, err
+		}
+	}
+
+	return id, nil
+}
+
+type storedFile struct {
+	path string
+	size int64
+	mod  int64
+}
+
+// scan lists the stored files and their total size.
+func (s *Store) scan() ([]storedFile, int64, error) {
+	var files []storedFile
+	var total int64
+
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !validID(info.Name()) {
+			return nil
+		}
+		files = append(files, storedFile{path: path, size: info.Size(), mod: info.ModTime().UnixNano()})
+		total += info.Size()
+		return nil
+	})
+
+	return files, total, err
+}
+
+// evict removes the oldest files until the store fits in its quota. The file
+// that was just saved is kept even if it alone exceeds the quota.
+func (s *Store) evict(keep string) error {
+	files, total, err := s.scan()
+	if err != nil {
+		return err
+	}
+	// The scan also catches files removed or added behind our back.
+	s.used = total
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].mod < files[j].mod
+	})
+
+	for _, file := range files {
+		if total <= s.quota {
+			break
+		}
+		if filepath.Base(file.path) == keep {
+			continue
+		}
+		if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= file.size
+		s.used = total
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "gateway"
+
+var (
+	MessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "Messages received from WhatsApp, by type.",
+	}, []string{"type"})
+
+	MessagesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_sent_total",
+		Help:      "Messages sent to WhatsApp, by type.",
+	}, []string{"type"})
+
+	SendFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_send_failures_total",
+		Help:      "Messages WhatsApp didn't accept, by type.",
+	}, []string{"type"})
+
+	WebhookDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "webhook_duration_seconds",
+		Help:      "Time taken to deliver webhook posts, including failed ones.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	WebhookFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_failures_total",
+		Help:      "Webhook posts that failed or got a status other than 200.",
+	})
+
+	WebhookQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "webhook_queue_depth",
+		Help:      "Webhook posts in flight.",
+	})
+
+	MediaDownloadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "media_downloaded_bytes_total",
+		Help:      "Bytes of media downloaded from WhatsApp.",
+	})
+
+	MediaUploadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "media_uploaded_bytes_total",
+		Help:      "Bytes of media uploaded to WhatsApp.",
+	})
+
+	Reconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "whatsapp_reconnects_total",
+		Help:      "Connections to WhatsApp after the first one.",
+	})
+
+	Connected = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "whatsapp_connected",
+		Help:      "1 while connected and logged in to WhatsApp.",
+	})
+
+	StreamClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stream_clients",
+		Help:      "WebSocket and SSE clients connected to the event stream.",
+	})
+)
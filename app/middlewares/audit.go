@@ -0,0 +1,117 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/logging"
+	"github.com/hiddensetup/w/app/store"
+)
+
+// maxAuditError bounds the error text kept per audit entry.
+const maxAuditError = 500
+
+// targetFields are the request body fields naming the chat, group or user an
+// API call acts on, by preference.
+var targetFields = []string{"receiver", "chat", "jid", "phone"}
+
+// NewAudit returns a middleware factory recording calls in the audit log
+// under an action name, e.g. audit("message.send"). Entries are written after
+// the handler ran, with its outcome. A failure to write is logged but doesn't
+// fail the request.
+func NewAudit(audit *store.Store) func(action string) fiber.Handler {
+	return func(action string) fiber.Handler {
+		return func(c *fiber.Ctx) error {
+			key, _ := CurrentKey(c)
+			target := auditTarget(c)
+
+			err := c.Next()
+
+			status := c.Response().StatusCode()
+			if err != nil {
+				if fiberErr, ok := err.(*fiber.Error); ok {
+					status = fiberErr.Code
+				} else {
+					status = fiber.StatusInternalServerError
+				}
+			}
+
+			success, message := auditOutcome(status, c.Response().Body(), err)
+			requestID, _ := c.Locals(requestIDLocal).(string)
+
+			entry := store.AuditEntry{
+				Time:      time.Now(),
+				RequestID: requestID,
+				KeyID:     key.ID,
+				KeyName:   key.Name,
+				IP:        c.IP(),
+				Action:    action,
+				Method:    c.Method(),
+				Path:      c.Path(),
+				Target:    target,
+				Status:    status,
+				Success:   success,
+				Error:     message,
+			}
+
+			logger := logging.FromContext(c.UserContext())
+			logger.Info("Audit", "action", action, "key_id", key.ID, "ip", entry.IP, "jid", target, "status", status, "success", success)
+			if err := audit.AppendAudit(entry); err != nil {
+				logger.Error("Writing audit log failed", "action", action, "error", err)
+			}
+
+			return err
+		}
+	}
+}
+
+// auditTarget finds the JID a call acts on in the route or the request body.
+func auditTarget(c *fiber.Ctx) string {
+	if jid := c.Params("jid"); jid != "" {
+		return jid
+	}
+
+	var body map[string]interface{}
+	if json.Unmarshal(c.Body(), &body) == nil {
+		for _, field := range targetFields {
+			if value, ok := body[field].(string); ok && value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	for _, field := range targetFields {
+		if value := c.FormValue(field); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// auditOutcome tells whether a call succeeded. Some handlers answer 200 with
+// {"status": false}, so the body is checked as well.
+func auditOutcome(status int, body []byte, err error) (bool, string) {
+	var response struct {
+		Status *bool  `json:"status"`
+		Error  string `json:"error"`
+	}
+	json.Unmarshal(body, &response)
+
+	message := response.Error
+	if err != nil && message == "" {
+		message = err.Error()
+	}
+	if len(message) > maxAuditError {
+		message = message[:maxAuditError]
+	}
+
+	success := err == nil && status < 400
+	if response.Status != nil && !*response.Status {
+		success = false
+	}
+
+	return success, message
+}
@@ -1,17 +1,131 @@
 package middlewares
 
 import (
-	"os"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/config"
+	"github.com/hiddensetup/w/app/dto"
+	"github.com/hiddensetup/w/app/logging"
+	"github.com/hiddensetup/w/app/store"
 )
 
-func Auth(c *fiber.Ctx) error {
-	authKey := c.Query(`auth`)
+const apiKeyLocal = "apiKey"
 
-	if authKey != os.Getenv("API_KEY") {
-		return c.SendStatus(401)
+// Keys from the configuration. API_KEY is held by every integration, so it
+// gets all scopes but admin, which only ADMIN_API_KEY or a minted key has.
+const (
+	legacyKeyID = "env"
+	adminKeyID  = "env-admin"
+)
+
+var legacyScopes = []string{store.ScopeSend, store.ScopeRead, store.ScopeSession}
+
+// NewAuth authenticates requests with an API key from the Authorization
+// (Bearer) or X-API-Key header. The auth query parameter is still accepted
+// unless AUTH_ALLOW_QUERY=0, as it leaks keys into access logs. API_KEY and
+// ADMIN_API_KEY are read from cfg on every request, so a reload replaces
+// them. session returns the phone number of the logged in account, for keys
+// restricted to certain sessions.
+func NewAuth(keys *store.Store, cfg *config.Manager, session func() string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		settings := cfg.Get()
+
+		secret := requestSecret(c, settings.AuthAllowQuery)
+		if secret == "" {
+			return unauthorized(c)
+		}
+
+		key, err := lookupKey(keys, settings, secret)
+		if errors.Is(err, store.ErrNotFound) {
+			return unauthorized(c)
+		} else if err != nil {
+			logging.FromContext(c.UserContext()).Error("API key lookup failed", "error", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+
+		if len(key.Sessions) > 0 && !contains(key.Sessions, session()) {
+			return c.Status(fiber.StatusForbidden).JSON(dto.Response{Status: false, Error: "key is not valid for this session"})
+		}
+
+		c.Locals(apiKeyLocal, key)
+
+		return c.Next()
+	}
+}
+
+// RequireScope rejects requests whose key lacks the scope.
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key, ok := CurrentKey(c)
+		if !ok || !key.HasScope(scope) {
+			return c.Status(fiber.StatusForbidden).JSON(dto.Response{Status: false, Error: "missing scope " + scope})
+		}
+
+		return c.Next()
+	}
+}
+
+// CurrentKey returns the key the request was authenticated with.
+func CurrentKey(c *fiber.Ctx) (store.APIKey, bool) {
+	key, ok := c.Locals(apiKeyLocal).(store.APIKey)
+	return key, ok
+}
+
+func requestSecret(c *fiber.Ctx, allowQuery bool) string {
+	if header := c.Get(fiber.HeaderAuthorization); header != "" {
+		if scheme, token, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+
+	if header := c.Get("X-API-Key"); header != "" {
+		return strings.TrimSpace(header)
+	}
+
+	if allowQuery {
+		return c.Query(`auth`)
+	}
+
+	return ""
+}
+
+func lookupKey(keys *store.Store, settings *config.Config, secret string) (store.APIKey, error) {
+	if secretMatches(secret, settings.AdminAPIKey) {
+		return store.APIKey{ID: adminKeyID, Name: "ADMIN_API_KEY", Scopes: store.Scopes}, nil
+	}
+	if secretMatches(secret, settings.APIKey) {
+		return store.APIKey{ID: legacyKeyID, Name: "API_KEY", Scopes: legacyScopes}, nil
+	}
+
+	return keys.APIKeyBySecret(secret)
+}
+
+// secretMatches compares digests, so the comparison takes constant time
+// regardless of the lengths. An unset key matches nothing.
+func secretMatches(secret, configured string) bool {
+	if configured == "" {
+		return false
+	}
+
+	given, expected := sha256.Sum256([]byte(secret)), sha256.Sum256([]byte(configured))
+	return subtle.ConstantTimeCompare(given[:], expected[:]) == 1
+}
+
+func unauthorized(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="api"`)
+	return c.SendStatus(fiber.StatusUnauthorized)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
 	}
 
-	return c.Next()
+	return false
 }
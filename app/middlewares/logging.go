@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/hiddensetup/w/app/logging"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDLocal  = "requestID"
+)
+
+// RequestLogger gives every request an ID, taken from X-Request-ID when the
+// client sends one, and returns it in the response. Handlers find a logger
+// tagged with the ID in c.UserContext(), so the ID follows the request into
+// the send paths. Finished requests are logged at debug level, by route.
+func RequestLogger(c *fiber.Ctx) error {
+	// The admin routes may share the app with the API routes.
+	if c.Locals(requestIDLocal) != nil {
+		return c.Next()
+	}
+
+	id := c.Get(requestIDHeader)
+	if id == "" || len(id) > 64 {
+		id = uuid.NewString()
+	}
+	c.Set(requestIDHeader, id)
+	c.Locals(requestIDLocal, id)
+	c.SetUserContext(logging.WithRequestID(c.UserContext(), id))
+
+	started := time.Now()
+	err := c.Next()
+
+	// The route template, the path itself holds JIDs and phone numbers.
+	logging.FromContext(c.UserContext()).Debug("Request finished",
+		"method", c.Method(),
+		"route", c.Route().Path,
+		"status", c.Response().StatusCode(),
+		"duration", time.Since(started).Round(time.Millisecond),
+	)
+
+	return err
+}
@@ -0,0 +1,60 @@
+package middlewares
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/config"
+	"github.com/hiddensetup/w/app/dto"
+)
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// NewRateLimit limits each API key to RATE_LIMIT requests per minute. The
+// limit is read from cfg on every request, so a reload changes it. It must
+// run after NewAuth.
+func NewRateLimit(cfg *config.Manager) fiber.Handler {
+	var mu sync.Mutex
+	windows := make(map[string]*rateWindow)
+
+	return func(c *fiber.Ctx) error {
+		limit := cfg.Get().RateLimit
+		if limit <= 0 {
+			return c.Next()
+		}
+
+		key, _ := CurrentKey(c)
+		now := time.Now()
+		start := now.Truncate(time.Minute)
+
+		mu.Lock()
+		window := windows[key.ID]
+		if window == nil || !window.start.Equal(start) {
+			window = &rateWindow{start: start}
+			windows[key.ID] = window
+		}
+		window.count++
+		count := window.count
+		mu.Unlock()
+
+		remaining := limit - count
+		if remaining < 0 {
+			remaining = 0
+		}
+		c.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+
+		if count > limit {
+			retry := start.Add(time.Minute).Sub(now)
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(retry.Seconds())+1))
+			return c.Status(fiber.StatusTooManyRequests).JSON(dto.Response{Status: false, Error: "rate limit exceeded"})
+		}
+
+		return c.Next()
+	}
+}
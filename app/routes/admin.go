@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/config"
+	"github.com/hiddensetup/w/app/controllers"
+	"github.com/hiddensetup/w/app/middlewares"
+	"github.com/hiddensetup/w/app/store"
+)
+
+// SetupAdmin registers the process control endpoints. They need an admin
+// key, and every call is recorded in the audit log. app is either the main
+// app or a separate one bound to ADMIN_LISTEN.
+func SetupAdmin(app *fiber.App, controller *controllers.Controller, appStore *store.Store, cfg *config.Manager) {
+	admin := app.Group("/admin",
+		middlewares.RequestLogger,
+		middlewares.NewAuth(appStore, cfg, controller.SessionUser),
+		middlewares.RequireScope(store.ScopeAdmin),
+	)
+	audit := middlewares.NewAudit(appStore)
+
+	admin.Post("/restart", audit("admin.restart"), controller.Restart)
+	admin.Post("/shutdown", audit("admin.shutdown"), controller.Shutdown)
+	admin.Post("/reload", audit("admin.reload"), controller.Reload)
+}
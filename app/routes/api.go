@@ -1,24 +1,93 @@
 package routes
 
 import (
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/hiddensetup/w/app/config"
 	"github.com/hiddensetup/w/app/controllers"
 	"github.com/hiddensetup/w/app/middlewares"
+	"github.com/hiddensetup/w/app/store"
 )
 
-func Setup(app *fiber.App, controller *controllers.Controller) {
+func Setup(app *fiber.App, controller *controllers.Controller, appStore *store.Store, cfg *config.Manager) {
 	app.Use(cors.New())
-	app.Use("/api", middlewares.Auth)
+	app.Use(middlewares.RequestLogger)
+	app.Use("/api", middlewares.NewAuth(appStore, cfg, controller.SessionUser), middlewares.NewRateLimit(cfg))
 
-	app.Get("/api/user/login", controller.Login)
-	app.Get("/api/user/logout", controller.Logout)
-	app.Get("/api/user/off", controller.Off)
+	read := middlewares.RequireScope(store.ScopeRead)
+	send := middlewares.RequireScope(store.ScopeSend)
+	admin := middlewares.RequireScope(store.ScopeAdmin)
+	session := middlewares.RequireScope(store.ScopeSession)
+	audit := middlewares.NewAudit(appStore)
 
-	app.Post("/api/message/send", controller.SendMessage)
-	app.Get("/api/message/last", controller.LastMessage)
+	app.Get("/api/user/login", session, audit("session.login"), controller.Login)
+	app.Get("/api/user/logout", session, audit("session.logout"), controller.Logout)
+	app.Get("/api/session", read, controller.Session)
 
-	app.Get("/api/tool/check-number/:number", controller.NumberInfo)
-	app.Get("/api/user/execute", controller.ExecuteScript)
+	app.Get("/api/events/ws", read, controller.EventsUpgrade, websocket.New(controller.EventsWebSocket))
+	app.Get("/api/events/sse", read, controller.EventsSSE)
+
+	app.Post("/api/message/send", send, audit("message.send"), controller.SendMessage)
+	app.Get("/api/message/last", read, controller.LastMessage)
+	app.Post("/api/message/read", send, audit("message.read"), controller.MarkRead)
+	app.Get("/api/message/:id/media", read, controller.MessageMedia)
+	app.Post("/api/message/:id/labels/:label", send, audit("message.label"), controller.LabelMessage)
+	app.Delete("/api/message/:id/labels/:label", send, audit("message.unlabel"), controller.UnlabelMessage)
+	app.Get("/api/media/:id", read, controller.Media)
+
+	app.Post("/api/presence", send, audit("presence.set"), controller.SetPresence)
+	app.Post("/api/presence/chat", send, audit("presence.chat"), controller.SetChatPresence)
+	app.Post("/api/presence/subscribe/:jid", send, audit("presence.subscribe"), controller.SubscribePresence)
+
+	app.Post("/api/status", send, audit("status.post"), controller.PostStatus)
+	app.Get("/api/status/privacy", read, controller.StatusPrivacy)
+
+	app.Post("/api/chats/:jid/archive", send, audit("chat.archive"), controller.ArchiveChat)
+	app.Post("/api/chats/:jid/pin", send, audit("chat.pin"), controller.PinChat)
+	app.Post("/api/chats/:jid/mute", send, audit("chat.mute"), controller.MuteChat)
+	app.Post("/api/chats/:jid/read", send, audit("chat.read"), controller.MarkChat)
+	app.Post("/api/chats/:jid/clear", send, audit("chat.clear"), controller.ClearChat)
+	app.Delete("/api/chats/:jid", send, audit("chat.delete"), controller.DeleteChat)
+	app.Get("/api/chats/:jid/labels", read, controller.ChatLabels)
+	app.Post("/api/chats/:jid/labels/:label", send, audit("chat.label"), controller.LabelChat)
+	app.Delete("/api/chats/:jid/labels/:label", send, audit("chat.unlabel"), controller.UnlabelChat)
+
+	app.Get("/api/labels", read, controller.Labels)
+
+	app.Get("/api/tool/check-number/:number", read, controller.NumberInfo)
+	app.Get("/api/contacts", read, controller.Contacts)
+	app.Get("/api/contacts/:jid", read, controller.ContactProfile)
+	app.Get("/api/contacts/:jid/avatar", read, controller.ContactAvatar)
+
+	app.Get("/api/settings/groups", admin, controller.GroupSettings)
+	app.Put("/api/settings/groups", admin, audit("settings.groups"), controller.UpdateGroupSettings)
+	app.Get("/api/settings/read", admin, controller.ReadSettings)
+	app.Put("/api/settings/read", admin, audit("settings.read"), controller.UpdateReadSettings)
+
+	app.Get("/api/rules", admin, controller.Rules)
+	app.Post("/api/rules", admin, audit("rule.create"), controller.CreateRule)
+	app.Post("/api/rules/reload", admin, audit("rule.reload"), controller.ReloadRules)
+	app.Put("/api/rules/:id", admin, audit("rule.update"), controller.UpdateRule)
+	app.Delete("/api/rules/:id", admin, audit("rule.delete"), controller.DeleteRule)
+
+	app.Get("/api/keys", admin, controller.APIKeys)
+	app.Post("/api/keys", admin, audit("key.create"), controller.CreateAPIKey)
+	app.Delete("/api/keys/:id", admin, audit("key.delete"), controller.DeleteAPIKey)
+
+	app.Get("/api/audit", admin, controller.AuditLog)
+
+	app.Get("/api/groups", read, controller.Groups)
+	app.Post("/api/groups", send, audit("group.create"), controller.CreateGroup)
+	app.Post("/api/groups/join", send, audit("group.join"), controller.JoinGroup)
+	app.Get("/api/groups/:jid", read, controller.GroupInfo)
+	app.Delete("/api/groups/:jid", send, audit("group.leave"), controller.LeaveGroup)
+	app.Get("/api/groups/:jid/participants", read, controller.GroupParticipants)
+	app.Post("/api/groups/:jid/participants/:action", send, audit("group.participants"), controller.UpdateGroupParticipants)
+	app.Put("/api/groups/:jid/subject", send, audit("group.subject"), controller.SetGroupSubject)
+	app.Put("/api/groups/:jid/description", send, audit("group.description"), controller.SetGroupDescription)
+	app.Put("/api/groups/:jid/photo", send, audit("group.photo"), controller.SetGroupPhoto)
+	app.Get("/api/groups/:jid/invite", read, controller.GroupInviteLink)
+	app.Delete("/api/groups/:jid/invite", send, audit("group.revoke_invite"), controller.RevokeGroupInviteLink)
 
 }
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/hiddensetup/w/app/controllers"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// SetupHealth registers the probes and metrics, outside /api so they need no
+// API key.
+func SetupHealth(app *fiber.App, controller *controllers.Controller) {
+	app.Get("/healthz", controller.Healthz)
+	app.Get("/readyz", controller.Readyz)
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+}
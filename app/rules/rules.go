@@ -0,0 +1,207 @@
+package rules
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Actions a rule can take on a matching message.
+const (
+	ActionDrop    = "drop"
+	ActionForward = "forward"
+	ActionReply   = "reply"
+	ActionTag     = "tag"
+)
+
+// Scopes restricting a rule to group or direct chats.
+const (
+	ScopeAny    = ""
+	ScopeGroup  = "group"
+	ScopeDirect = "direct"
+)
+
+type Rule struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	Enabled  bool   `json:"enabled"`
+	Match    Match  `json:"match"`
+	Action   Action `json:"action"`
+}
+
+// Match conditions are combined with AND, empty conditions match everything.
+// Chat and Sender are glob patterns as understood by path.Match, e.g.
+// "*@g.us" or "34*@s.whatsapp.net".
+type Match struct {
+	Chat       string   `json:"chat"`
+	Sender     string   `json:"sender"`
+	Scope      string   `json:"scope"`
+	Keywords   []string `json:"keywords"`
+	MediaTypes []string `json:"mediaTypes"`
+	FromMe     *bool    `json:"fromMe"`
+}
+
+type Action struct {
+	Type    string `json:"type"`
+	Webhook string `json:"webhook,omitempty"`
+	Reply   string `json:"reply,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+}
+
+// Message is the part of an incoming message the rules are evaluated against.
+type Message struct {
+	Chat      string
+	Sender    string
+	IsGroup   bool
+	IsFromMe  bool
+	MediaType string
+	Text      string
+}
+
+// Result collects the actions of all matching rules. When Webhooks is empty
+// the message goes to the default webhook.
+type Result struct {
+	Drop     bool
+	Webhooks []string
+	Replies  []string
+	Tags     []string
+}
+
+func (r Rule) Validate() error {
+	for _, pattern := range []string{r.Match.Chat, r.Match.Sender} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.New("invalid pattern: " + pattern)
+		}
+	}
+
+	switch r.Match.Scope {
+	case ScopeAny, ScopeGroup, ScopeDirect:
+	default:
+		return errors.New("scope must be empty, group or direct")
+	}
+
+	switch r.Action.Type {
+	case ActionDrop:
+	case ActionForward:
+		u, err := url.Parse(r.Action.Webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("forward action needs an http(s) webhook")
+		}
+	case ActionReply:
+		if strings.TrimSpace(r.Action.Reply) == "" {
+			return errors.New("reply action needs a reply text")
+		}
+	case ActionTag:
+		if strings.TrimSpace(r.Action.Tag) == "" {
+			return errors.New("tag action needs a tag")
+		}
+	default:
+		return errors.New("action must be drop, forward, reply or tag")
+	}
+
+	return nil
+}
+
+func (m Match) matches(msg Message) bool {
+	if m.Chat != "" {
+		if ok, _ := path.Match(m.Chat, msg.Chat); !ok {
+			return false
+		}
+	}
+	if m.Sender != "" {
+		if ok, _ := path.Match(m.Sender, msg.Sender); !ok {
+			return false
+		}
+	}
+	if (m.Scope == ScopeGroup && !msg.IsGroup) || (m.Scope == ScopeDirect && msg.IsGroup) {
+		return false
+	}
+	if m.FromMe != nil && *m.FromMe != msg.IsFromMe {
+		return false
+	}
+
+	if len(m.MediaTypes) > 0 {
+		found := false
+		for _, mediaType := range m.MediaTypes {
+			if strings.EqualFold(mediaType, msg.MediaType) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(m.Keywords) > 0 {
+		text := strings.ToLower(msg.Text)
+		found := false
+		for _, keyword := range m.Keywords {
+			if keyword != "" && strings.Contains(text, strings.ToLower(keyword)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Engine evaluates the active rule set. Load swaps the rules atomically, so
+// they can be reloaded while messages are being processed.
+type Engine struct {
+	rules atomic.Value
+}
+
+func NewEngine() *Engine {
+	e := &Engine{}
+	e.rules.Store([]Rule{})
+	return e
+}
+
+func (e *Engine) Load(rules []Rule) {
+	sorted := make([]Rule, len(rules))
+	copy(sorted, rules)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+
+	e.rules.Store(sorted)
+}
+
+func (e *Engine) Rules() []Rule {
+	return e.rules.Load().([]Rule)
+}
+
+// Evaluate applies enabled rules by descending priority. A matching drop rule
+// stops the evaluation.
+func (e *Engine) Evaluate(msg Message) Result {
+	result := Result{}
+
+	for _, rule := range e.Rules() {
+		if !rule.Enabled || !rule.Match.matches(msg) {
+			continue
+		}
+
+		switch rule.Action.Type {
+		case ActionDrop:
+			result.Drop = true
+			return result
+		case ActionForward:
+			result.Webhooks = append(result.Webhooks, rule.Action.Webhook)
+		case ActionReply:
+			result.Replies = append(result.Replies, rule.Action.Reply)
+		case ActionTag:
+			result.Tags = append(result.Tags, rule.Action.Tag)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// AuditEntry records an API call that changed something: who made it, from
+// where, on which chat or group, and how it ended.
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId"`
+	KeyID     string    `json:"keyId"`
+	KeyName   string    `json:"keyName"`
+	IP        string    `json:"ip"`
+	Action    string    `json:"action"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Target    string    `json:"target"`
+	Status    int       `json:"status"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error"`
+}
+
+// AuditFilter selects audit entries. Zero values don't filter.
+type AuditFilter struct {
+	Since  time.Time
+	Until  time.Time
+	KeyID  string
+	Action string
+	Target string
+	Limit  int
+	Offset int
+}
+
+func (s *Store) AppendAudit(entry AuditEntry) error {
+	_, err := s.db.Exec(`INSERT INTO audit_log (time, request_id, key_id, key_name, ip, action, method, path, target, status, success, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Time.UnixMilli(), entry.RequestID, entry.KeyID, entry.KeyName, entry.IP, entry.Action,
+		entry.Method, entry.Path, entry.Target, entry.Status, entry.Success, entry.Error)
+	return err
+}
+
+// AuditEntries calls fn for the matching entries, newest first.
+func (s *Store) AuditEntries(filter AuditFilter, fn func(AuditEntry) error) error {
+	var conditions []string
+	var args []interface{}
+
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, `time >= ?`)
+		args = append(args, filter.Since.UnixMilli())
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, `time < ?`)
+		args = append(args, filter.Until.UnixMilli())
+	}
+	if filter.KeyID != "" {
+		conditions = append(conditions, `key_id = ?`)
+		args = append(args, filter.KeyID)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, `action = ?`)
+		args = append(args, filter.Action)
+	}
+	if filter.Target != "" {
+		conditions = append(conditions, `target = ?`)
+		args = append(args, filter.Target)
+	}
+
+	query := `SELECT id, time, request_id, key_id, key_name, ip, action, method, path, target, status, success, error FROM audit_log`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	query += ` ORDER BY id DESC`
+	if filter.Limit > 0 || filter.Offset > 0 {
+		// SQLite needs a LIMIT for OFFSET, -1 means none.
+		limit := filter.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, filter.Offset)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry AuditEntry
+		var millis int64
+		if err := rows.Scan(&entry.ID, &millis, &entry.RequestID, &entry.KeyID, &entry.KeyName, &entry.IP, &entry.Action,
+			&entry.Method, &entry.Path, &entry.Target, &entry.Status, &entry.Success, &entry.Error); err != nil {
+			return err
+		}
+		entry.Time = time.UnixMilli(millis)
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
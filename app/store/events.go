@@ -0,0 +1,67 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event is an event as streamed to WebSocket and SSE clients. Events are kept
+// for a while so clients can resume from the last ID they saw.
+type Event struct {
+	ID      int64           `json:"id"`
+	Time    time.Time       `json:"time"`
+	Type    string          `json:"type"`
+	Chat    string          `json:"chat,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// AppendEvent stores the event and returns it with its ID and time set.
+func (s *Store) AppendEvent(eventType, chat string, payload json.RawMessage) (Event, error) {
+	event := Event{Time: time.Now(), Type: eventType, Chat: chat, Payload: payload}
+
+	result, err := s.db.Exec(`INSERT INTO events (time, type, chat, payload) VALUES (?, ?, ?, ?)`,
+		event.Time.UnixMilli(), event.Type, event.Chat, string(event.Payload))
+	if err != nil {
+		return event, err
+	}
+
+	event.ID, err = result.LastInsertId()
+	return event, err
+}
+
+// Events returns up to limit events after the one with ID afterID, oldest
+// first. They are read into memory, so sending them to slow clients doesn't
+// keep a read lock on the database that would block writers.
+func (s *Store) Events(afterID int64, limit int) ([]Event, error) {
+	rows, err := s.db.Query(`SELECT id, time, type, chat, payload FROM events WHERE id > ? ORDER BY id LIMIT ?`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		var millis int64
+		var payload string
+		if err := rows.Scan(&event.ID, &millis, &event.Type, &event.Chat, &payload); err != nil {
+			return nil, err
+		}
+		event.Time = time.UnixMilli(millis)
+		event.Payload = json.RawMessage(payload)
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// PruneEvents deletes the events older than before.
+func (s *Store) PruneEvents(before time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM events WHERE time < ?`, before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
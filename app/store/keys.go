@@ -0,0 +1,122 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// API key scopes. Admin implies all other scopes.
+const (
+	ScopeSend    = "send"
+	ScopeRead    = "read"
+	ScopeAdmin   = "admin"
+	ScopeSession = "session"
+)
+
+var Scopes = []string{ScopeSend, ScopeRead, ScopeAdmin, ScopeSession}
+
+// APIKey is an API key without its secret, only the SHA256 of the secret is
+// stored. Sessions, when not empty, lists the WhatsApp accounts (phone
+// numbers) the key may be used with.
+type APIKey struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Scopes   []string  `json:"scopes"`
+	Sessions []string  `json:"sessions"`
+	Created  time.Time `json:"created"`
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+func HashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Store) CreateAPIKey(key APIKey, secret string) error {
+	_, err := s.db.Exec(`INSERT INTO api_keys (id, name, hash, scopes, sessions, created) VALUES (?, ?, ?, ?, ?, ?)`,
+		key.ID, key.Name, HashKey(secret), strings.Join(key.Scopes, ","), strings.Join(key.Sessions, ","), key.Created.Unix())
+	return err
+}
+
+func (s *Store) APIKeys() ([]APIKey, error) {
+	rows, err := s.db.Query(`SELECT id, name, scopes, sessions, created FROM api_keys ORDER BY created`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// APIKeyBySecret finds the key for a secret presented by a client.
+func (s *Store) APIKeyBySecret(secret string) (APIKey, error) {
+	row := s.db.QueryRow(`SELECT id, name, scopes, sessions, created FROM api_keys WHERE hash = ?`, HashKey(secret))
+
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, ErrNotFound
+	}
+
+	return key, err
+}
+
+func (s *Store) DeleteAPIKey(id string) error {
+	res, err := s.db.Exec(`DELETE FROM api_keys WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row scanner) (APIKey, error) {
+	var key APIKey
+	var scopes, sessions string
+	var created int64
+	if err := row.Scan(&key.ID, &key.Name, &scopes, &sessions, &created); err != nil {
+		return key, err
+	}
+
+	key.Scopes = splitNonEmpty(scopes)
+	key.Sessions = splitNonEmpty(sessions)
+	key.Created = time.Unix(created, 0)
+
+	return key, nil
+}
+
+func splitNonEmpty(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
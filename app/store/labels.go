@@ -0,0 +1,154 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Label is a WhatsApp Business label. Chats lists the chats tagged with it.
+type Label struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Color        int32    `json:"color"`
+	PredefinedID int32    `json:"predefinedId"`
+	Chats        []string `json:"chats"`
+}
+
+// SaveLabel creates or renames a label.
+func (s *Store) SaveLabel(label Label) error {
+	_, err := s.db.Exec(`INSERT INTO labels (id, name, color, predefined_id) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name, color = excluded.color, predefined_id = excluded.predefined_id`,
+		label.ID, label.Name, label.Color, label.PredefinedID)
+	return err
+}
+
+// DeleteLabel deletes a label along with its chat and message tags.
+func (s *Store) DeleteLabel(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM labels WHERE id = ?`,
+		`DELETE FROM label_chats WHERE label_id = ?`,
+		`DELETE FROM label_messages WHERE label_id = ?`,
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ClearLabels deletes all labels and tags, before syncing another account's.
+func (s *Store) ClearLabels() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{`labels`, `label_chats`, `label_messages`} {
+		if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Labels returns the labels with their chats, ordered by name.
+func (s *Store) Labels() ([]Label, error) {
+	rows, err := s.db.Query(`SELECT id, name, color, predefined_id FROM labels ORDER BY name, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := []Label{}
+	index := make(map[string]int)
+	for rows.Next() {
+		label := Label{Chats: []string{}}
+		if err := rows.Scan(&label.ID, &label.Name, &label.Color, &label.PredefinedID); err != nil {
+			return nil, err
+		}
+		index[label.ID] = len(labels)
+		labels = append(labels, label)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	chats, err := s.db.Query(`SELECT label_id, chat FROM label_chats ORDER BY chat`)
+	if err != nil {
+		return nil, err
+	}
+	defer chats.Close()
+
+	for chats.Next() {
+		var labelID, chat string
+		if err := chats.Scan(&labelID, &chat); err != nil {
+			return nil, err
+		}
+		if i, ok := index[labelID]; ok {
+			labels[i].Chats = append(labels[i].Chats, chat)
+		}
+	}
+
+	return labels, chats.Err()
+}
+
+// LabelExists reports whether the label is known.
+func (s *Store) LabelExists(id string) (bool, error) {
+	err := s.db.QueryRow(`SELECT 1 FROM labels WHERE id = ?`, id).Scan(new(int))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// LabelChat tags or untags a chat.
+func (s *Store) LabelChat(labelID, chat string, labeled bool) error {
+	query := `INSERT OR IGNORE INTO label_chats (label_id, chat) VALUES (?, ?)`
+	if !labeled {
+		query = `DELETE FROM label_chats WHERE label_id = ? AND chat = ?`
+	}
+
+	_, err := s.db.Exec(query, labelID, chat)
+	return err
+}
+
+// LabelMessage tags or untags a message.
+func (s *Store) LabelMessage(labelID, chat, messageID string, labeled bool) error {
+	query := `INSERT OR IGNORE INTO label_messages (label_id, chat, message_id) VALUES (?, ?, ?)`
+	if !labeled {
+		query = `DELETE FROM label_messages WHERE label_id = ? AND chat = ? AND message_id = ?`
+	}
+
+	_, err := s.db.Exec(query, labelID, chat, messageID)
+	return err
+}
+
+// ChatLabels returns the IDs of the labels on a chat.
+func (s *Store) ChatLabels(chat string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT label_id FROM label_chats WHERE chat = ? ORDER BY label_id`, chat)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
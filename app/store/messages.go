@@ -0,0 +1,108 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Message is the metadata of a received message. Raw is the serialized
+// waProto.Message, which keeps the media keys and paths needed to download
+// its attachment again.
+type Message struct {
+	ID        string
+	Chat      string
+	Sender    string
+	PushName  string
+	IsFromMe  bool
+	IsGroup   bool
+	Timestamp time.Time
+	MediaType string
+	Raw       []byte
+}
+
+func (s *Store) SaveMessage(msg Message) error {
+	_, err := s.db.Exec(`INSERT INTO messages (chat, id, sender, push_name, from_me, is_group, timestamp, media_type, message)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat, id) DO UPDATE SET message = excluded.message, media_type = excluded.media_type`,
+		msg.Chat, msg.ID, msg.Sender, msg.PushName, msg.IsFromMe, msg.IsGroup, msg.Timestamp.Unix(), msg.MediaType, msg.Raw)
+	return err
+}
+
+// Message looks a message up by ID. Message IDs are only unique per chat, so
+// chat can be given to disambiguate, otherwise the newest match is returned.
+func (s *Store) Message(id, chat string) (Message, error) {
+	query := `SELECT chat, id, sender, push_name, from_me, is_group, timestamp, media_type, message
+		FROM messages WHERE id = ?`
+	args := []interface{}{id}
+	if chat != "" {
+		query += ` AND chat = ?`
+		args = append(args, chat)
+	}
+	query += ` ORDER BY timestamp DESC LIMIT 1`
+
+	var msg Message
+	var timestamp int64
+	err := s.db.QueryRow(query, args...).Scan(&msg.Chat, &msg.ID, &msg.Sender, &msg.PushName,
+		&msg.IsFromMe, &msg.IsGroup, &timestamp, &msg.MediaType, &msg.Raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return msg, ErrNotFound
+	} else if err != nil {
+		return msg, err
+	}
+	msg.Timestamp = time.Unix(timestamp, 0)
+
+	return msg, nil
+}
+
+// LatestMessage returns the newest stored message of chat.
+func (s *Store) LatestMessage(chat string) (Message, error) {
+	var msg Message
+	var timestamp int64
+	err := s.db.QueryRow(`SELECT chat, id, sender, push_name, from_me, is_group, timestamp, media_type, message
+		FROM messages WHERE chat = ? ORDER BY timestamp DESC LIMIT 1`, chat).Scan(&msg.Chat, &msg.ID, &msg.Sender,
+		&msg.PushName, &msg.IsFromMe, &msg.IsGroup, &timestamp, &msg.MediaType, &msg.Raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return msg, ErrNotFound
+	} else if err != nil {
+		return msg, err
+	}
+	msg.Timestamp = time.Unix(timestamp, 0)
+
+	return msg, nil
+}
+
+// Messages calls fn for the stored messages, oldest first, optionally only
+// those of chat and newer than since.
+func (s *Store) Messages(chat string, since time.Time, fn func(Message) error) error {
+	query := `SELECT chat, id, sender, push_name, from_me, is_group, timestamp, media_type, message
+		FROM messages WHERE timestamp >= ?`
+	args := []interface{}{since.Unix()}
+	if chat != "" {
+		query += ` AND chat = ?`
+		args = append(args, chat)
+	}
+	query += ` ORDER BY timestamp`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg Message
+		var timestamp int64
+		if err := rows.Scan(&msg.Chat, &msg.ID, &msg.Sender, &msg.PushName,
+			&msg.IsFromMe, &msg.IsGroup, &timestamp, &msg.MediaType, &msg.Raw); err != nil {
+			return err
+		}
+		msg.Timestamp = time.Unix(timestamp, 0)
+
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/hiddensetup/w/app/rules"
+)
+
+var ErrNotFound = errors.New("not found")
+
+func (s *Store) Rules() ([]rules.Rule, error) {
+	rows, err := s.db.Query(`SELECT id, name, priority, enabled, match, action FROM rules ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []rules.Rule{}
+	for rows.Next() {
+		var rule rules.Rule
+		var match, action string
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.Priority, &rule.Enabled, &match, &action); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(match), &rule.Match); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(action), &rule.Action); err != nil {
+			return nil, err
+		}
+		result = append(result, rule)
+	}
+
+	return result, rows.Err()
+}
+
+// SaveRule inserts the rule when its ID is zero and updates it otherwise.
+func (s *Store) SaveRule(rule *rules.Rule) error {
+	match, err := json.Marshal(rule.Match)
+	if err != nil {
+		return err
+	}
+	action, err := json.Marshal(rule.Action)
+	if err != nil {
+		return err
+	}
+
+	if rule.ID == 0 {
+		res, err := s.db.Exec(`INSERT INTO rules (name, priority, enabled, match, action) VALUES (?, ?, ?, ?, ?)`,
+			rule.Name, rule.Priority, rule.Enabled, string(match), string(action))
+		if err != nil {
+			return err
+		}
+		rule.ID, err = res.LastInsertId()
+		return err
+	}
+
+	res, err := s.db.Exec(`UPDATE rules SET name = ?, priority = ?, enabled = ?, match = ?, action = ? WHERE id = ?`,
+		rule.Name, rule.Priority, rule.Enabled, string(match), string(action), rule.ID)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (s *Store) DeleteRule(id int64) error {
+	res, err := s.db.Exec(`DELETE FROM rules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func expectAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Store keeps the gateway's own data (settings, rules, message metadata, ...)
+// in a separate SQLite database, so it survives logging out of WhatsApp which
+// removes whatsappstore.db.
+type Store struct {
+	db *sql.DB
+}
+
+// migrations are applied in order, the index of the last applied one is kept
+// in the gateway_version table. Only ever append to this list.
+var migrations = []string{
+	`CREATE TABLE settings (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE rules (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		name     TEXT NOT NULL,
+		priority INTEGER NOT NULL DEFAULT 0,
+		enabled  BOOLEAN NOT NULL DEFAULT true,
+		match    TEXT NOT NULL,
+		action   TEXT NOT NULL
+	)`,
+	`CREATE TABLE messages (
+		chat       TEXT NOT NULL,
+		id         TEXT NOT NULL,
+		sender     TEXT NOT NULL,
+		push_name  TEXT NOT NULL DEFAULT '',
+		from_me    BOOLEAN NOT NULL,
+		is_group   BOOLEAN NOT NULL,
+		timestamp  INTEGER NOT NULL,
+		media_type TEXT NOT NULL DEFAULT '',
+		message    BLOB NOT NULL,
+		PRIMARY KEY (chat, id)
+	)`,
+	`CREATE INDEX messages_id ON messages (id)`,
+	`CREATE TABLE api_keys (
+		id       TEXT PRIMARY KEY,
+		name     TEXT NOT NULL,
+		hash     TEXT NOT NULL UNIQUE,
+		scopes   TEXT NOT NULL,
+		sessions TEXT NOT NULL DEFAULT '',
+		created  INTEGER NOT NULL
+	)`,
+	`CREATE TABLE audit_log (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		time       INTEGER NOT NULL,
+		request_id TEXT NOT NULL DEFAULT '',
+		key_id     TEXT NOT NULL,
+		key_name   TEXT NOT NULL DEFAULT '',
+		ip         TEXT NOT NULL DEFAULT '',
+		action     TEXT NOT NULL,
+		method     TEXT NOT NULL,
+		path       TEXT NOT NULL,
+		target     TEXT NOT NULL DEFAULT '',
+		status     INTEGER NOT NULL,
+		success    BOOLEAN NOT NULL,
+		error      TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX audit_log_time ON audit_log (time)`,
+	// The audit log is append-only.
+	`CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END`,
+	`CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END`,
+	`CREATE TABLE events (
+		id      INTEGER PRIMARY KEY AUTOINCREMENT,
+		time    INTEGER NOT NULL,
+		type    TEXT NOT NULL,
+		chat    TEXT NOT NULL DEFAULT '',
+		payload TEXT NOT NULL
+	)`,
+	`CREATE INDEX events_time ON events (time)`,
+	`CREATE TABLE labels (
+		id            TEXT PRIMARY KEY,
+		name          TEXT NOT NULL,
+		color         INTEGER NOT NULL DEFAULT 0,
+		predefined_id INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE label_chats (
+		label_id TEXT NOT NULL,
+		chat     TEXT NOT NULL,
+		PRIMARY KEY (label_id, chat)
+	)`,
+	`CREATE TABLE label_messages (
+		label_id   TEXT NOT NULL,
+		chat       TEXT NOT NULL,
+		message_id TEXT NOT NULL,
+		PRIMARY KEY (label_id, chat, message_id)
+	)`,
+}
+
+func New(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", path))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{db: db}
+	if err := s.upgrade(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("upgrading gateway database: %w", err)
+	}
+
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *Store) upgrade() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS gateway_version (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+
+	version := 0
+	err := s.db.QueryRow(`SELECT version FROM gateway_version`).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := s.db.Exec(`INSERT INTO gateway_version (version) VALUES (0)`); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+		if _, err := tx.Exec(`UPDATE gateway_version SET version = ?`, version+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetSetting decodes the JSON stored under key into value. It reports false
+// when the setting was never saved, leaving value untouched.
+func (s *Store) GetSetting(key string, value interface{}) (bool, error) {
+	var raw string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal([]byte(raw), value)
+}
+
+func (s *Store) PutSetting(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, key, string(raw))
+	return err
+}
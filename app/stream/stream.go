@@ -0,0 +1,151 @@
+// Package stream fans the gateway's events out to WebSocket and SSE clients.
+package stream
+
+import (
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/hiddensetup/w/app/store"
+)
+
+// bufferSize is how many events a subscriber may fall behind before it is
+// dropped. Dropped clients reconnect and resume from the last ID they got.
+const bufferSize = 256
+
+// Filter selects events by type and chat. Chats are glob patterns as
+// understood by path.Match, like in rules. Empty lists match everything.
+type Filter struct {
+	Types []string
+	Chats []string
+}
+
+// ParseFilter reads comma separated types and chats and checks the patterns.
+func ParseFilter(types, chats string) (Filter, error) {
+	filter := Filter{Types: splitList(types), Chats: splitList(chats)}
+
+	for _, pattern := range filter.Chats {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// Matches reports whether the event passes the filter.
+func (f Filter) Matches(event store.Event) bool {
+	if len(f.Types) > 0 && !contains(f.Types, event.Type) {
+		return false
+	}
+
+	if len(f.Chats) > 0 {
+		for _, pattern := range f.Chats {
+			if ok, _ := path.Match(pattern, event.Chat); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Subscription receives the matching events published after it was created.
+// Events is closed when the subscriber falls behind or the hub closes.
+type Subscription struct {
+	Events <-chan store.Event
+	events chan store.Event
+	filter Filter
+}
+
+// Hub delivers published events to its subscriptions.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+func (h *Hub) Subscribe(filter Filter) *Subscription {
+	events := make(chan store.Event, bufferSize)
+	sub := &Subscription{Events: events, events: events, filter: filter}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(events)
+		return sub
+	}
+	h.subs[sub] = struct{}{}
+
+	return sub
+}
+
+// Unsubscribe removes the subscription, closing its channel.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Publish hands the event to every matching subscription without blocking.
+func (h *Hub) Publish(event store.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			delete(h.subs, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Close ends all subscriptions, so the streams end and shutdown isn't held up
+// by connections that never finish.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
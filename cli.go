@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hiddensetup/w/app/config"
+	"github.com/hiddensetup/w/app/controllers"
+)
+
+// connectTimeout bounds how long commands wait for the WhatsApp connection.
+const connectTimeout = 30 * time.Second
+
+type command struct {
+	usage       string
+	description string
+	run         func(cfg *config.Manager, args []string) error
+}
+
+// Usages the commands print on wrong arguments. They are constants since
+// commands can't refer to itself through the functions it holds.
+const (
+	sendUsage  = "send <jid> <text> [--media file]"
+	checkUsage = "check <number>..."
+)
+
+var commands = map[string]command{
+	"serve": {
+		usage:       "serve",
+		description: "run the gateway (default)",
+		run:         cmdServe,
+	},
+	"login": {
+		usage:       "login [--phone number]",
+		description: "link this gateway, with a QR code or a pairing code for --phone",
+		run:         cmdLogin,
+	},
+	"logout": {
+		usage:       "logout",
+		description: "unlink this gateway and remove the session",
+		run:         cmdLogout,
+	},
+	"status": {
+		usage:       "status",
+		description: "show whether the gateway runs and which account is linked",
+		run:         cmdStatus,
+	},
+	"send": {
+		usage:       sendUsage,
+		description: "send a message, with an optional file attached",
+		run:         cmdSend,
+	},
+	"check": {
+		usage:       checkUsage,
+		description: "check which numbers are on WhatsApp",
+		run:         cmdCheck,
+	},
+	"export": {
+		usage:       "export [--chat jid] [--since 2024-01-31] [--out file]",
+		description: "export stored messages as JSON lines",
+		run:         cmdExport,
+	},
+}
+
+// runCommand runs the subcommand named by the first argument, serve when
+// there is none.
+func runCommand(cfg *config.Manager, args []string) error {
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return nil
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		printUsage()
+		return errors.New("unknown command: " + name)
+	}
+
+	return cmd.run(cfg, args)
+}
+
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [arguments]\n\nCommands:\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-54s %s\n", commands[name].usage, commands[name].description)
+	}
+}
+
+// parseFlags parses flags given anywhere among the arguments, not only
+// before the first positional one as flag.FlagSet.Parse does, and returns
+// the positional arguments.
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func cmdServe(cfg *config.Manager, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	return serve(cfg)
+}
+
+func cmdLogin(cfg *config.Manager, args []string) error {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	phone := flags.String("phone", "", "link with a pairing code for this phone number instead of a QR code")
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	return withController(cfg, func(ctx context.Context, controller *controllers.Controller) error {
+		if err := controller.LoginTerminal(ctx, os.Stdout, *phone); err != nil {
+			return err
+		}
+
+		fmt.Println("Logged in as", controller.SessionStatus().JID)
+		return nil
+	})
+}
+
+func cmdLogout(cfg *config.Manager, args []string) error {
+	flags := flag.NewFlagSet("logout", flag.ExitOnError)
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	return withController(cfg, func(ctx context.Context, controller *controllers.Controller) error {
+		if !controller.SessionStatus().LoggedIn {
+			return errors.New("not logged in")
+		}
+		if err := connect(controller); err != nil {
+			return err
+		}
+
+		return controller.LogoutSession()
+	})
+}
+
+func cmdStatus(cfg *config.Manager, args []string) error {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if pid, ok := runningPID(cfg); ok {
+		fmt.Printf("Gateway:   running (PID %d)\n", pid)
+	} else {
+		fmt.Println("Gateway:   not running")
+	}
+
+	controller, appStore, err := openController(cfg)
+	if err != nil {
+		return err
+	}
+	defer appStore.Close()
+
+	status := controller.SessionStatus()
+	if !status.LoggedIn {
+		fmt.Println("WhatsApp:  not logged in")
+		return nil
+	}
+
+	fmt.Printf("WhatsApp:  logged in as %s", status.JID)
+	if status.PushName != "" {
+		fmt.Printf(" (%s)", status.PushName)
+	}
+	fmt.Println()
+
+	return nil
+}
+
+func cmdSend(cfg *config.Manager, args []string) error {
+	flags := flag.NewFlagSet("send", flag.ExitOnError)
+	mediaPath := flags.String("media", "", "file to attach")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 1 || (len(positional) < 2 && *mediaPath == "") {
+		return errors.New("usage: " + sendUsage)
+	}
+
+	receiver, text := positional[0], strings.Join(positional[1:], " ")
+
+	return withController(cfg, func(ctx context.Context, controller *controllers.Controller) error {
+		if err := connect(controller); err != nil {
+			return err
+		}
+
+		if err := controller.SendFile(ctx, receiver, text, *mediaPath); err != nil {
+			return err
+		}
+
+		fmt.Println("Sent")
+		return nil
+	})
+}
+
+func cmdCheck(cfg *config.Manager, args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	numbers, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(numbers) == 0 {
+		return errors.New("usage: " + checkUsage)
+	}
+
+	return withController(cfg, func(ctx context.Context, controller *controllers.Controller) error {
+		if err := connect(controller); err != nil {
+			return err
+		}
+
+		results, err := controller.CheckNumbers(numbers)
+		if err != nil {
+			return err
+		}
+
+		for _, result := range results {
+			if result.IsIn {
+				fmt.Printf("%s\ton WhatsApp\t%s\n", result.Query, result.JID)
+			} else {
+				fmt.Printf("%s\tnot on WhatsApp\n", result.Query)
+			}
+		}
+
+		return nil
+	})
+}
+
+func cmdExport(cfg *config.Manager, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	chat := flags.String("chat", "", "only export messages of this chat JID")
+	sinceValue := flags.String("since", "", "only export messages from this date (YYYY-MM-DD) on")
+	outPath := flags.String("out", "", "write to this file instead of standard output")
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	var since time.Time
+	if *sinceValue != "" {
+		var err error
+		if since, err = time.ParseInLocation("2006-01-02", *sinceValue, time.Local); err != nil {
+			return errors.New("invalid --since date: " + *sinceValue)
+		}
+	}
+
+	out := os.Stdout
+	if *outPath != "" {
+		file, err := os.Create(*outPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	// Only the gateway database is read, so this works while serving.
+	controller, appStore, err := openController(cfg)
+	if err != nil {
+		return err
+	}
+	defer appStore.Close()
+
+	count, err := controller.ExportMessages(out, *chat, since)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d messages\n", count)
+	return nil
+}
+
+// withController runs fn with a controller of its own. WhatsApp allows one
+// connection per linked device, so it refuses to run while the gateway is
+// serving, as connecting would disconnect the gateway.
+func withController(cfg *config.Manager, fn func(ctx context.Context, controller *controllers.Controller) error) error {
+	if pid, ok := runningPID(cfg); ok {
+		return fmt.Errorf("the gateway is running (PID %d), stop it first or use the API", pid)
+	}
+
+	controller, appStore, err := openController(cfg)
+	if err != nil {
+		return err
+	}
+	defer appStore.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err = fn(ctx, controller)
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	controller.Close(closeCtx)
+
+	return err
+}
+
+// connect connects the logged in session and waits until WhatsApp accepted
+// it.
+func connect(controller *controllers.Controller) error {
+	if !controller.SessionStatus().LoggedIn {
+		return errors.New("not logged in, run the login command first")
+	}
+	if err := controller.Autologin(); err != nil {
+		return err
+	}
+	if !controller.GetClient().WaitForConnection(connectTimeout) {
+		return errors.New("timed out connecting to WhatsApp")
+	}
+
+	return nil
+}
+
+// runningPID returns the PID from the PID file if that process is running.
+func runningPID(cfg *config.Manager) (int, bool) {
+	pidFile := cfg.Get().PIDFile
+	if pidFile == "" {
+		return 0, false
+	}
+
+	return readPIDFile(pidFile)
+}
@@ -39,6 +39,7 @@ LOG_LEVEL=$LOG_LEVEL
 PORT=$PORT
 AUTO_LOGIN=$AUTO_LOGIN
 BINARY_NAME=$BINARY_NAME
+PID_FILE=gateway.pid
 EOL
 
   echo ".env file created successfully."
@@ -49,9 +50,13 @@ get_binary_name() {
   grep "^BINARY_NAME=" "$ENV_FILE" | cut -d'=' -f2
 }
 
-# Function to get the PID from the .env file
+# Function to get the PID from the PID file the application writes
 get_pid() {
-  grep "^PID=" "$ENV_FILE" | cut -d'=' -f2
+  local pid_file=$(grep "^PID_FILE=" "$ENV_FILE" | cut -d'=' -f2)
+  pid_file=${pid_file:-gateway.pid}
+  if [ -f "$pid_file" ]; then
+    cat "$pid_file"
+  fi
 }
 
 # Function to stop the process
@@ -63,13 +68,22 @@ stop_process() {
   fi
 
   echo "Stopping process with PID $pid..."
-  kill "$pid" 2>/dev/null
-  if [ $? -eq 0 ]; then
-    echo "Process $pid stopped."
-  else
+  if ! kill -TERM "$pid" 2>/dev/null; then
     echo "Failed to stop process $pid or process does not exist."
     return 1
   fi
+
+  # The application shuts down gracefully, give it time to finish.
+  for _ in $(seq 1 35); do
+    if ! kill -0 "$pid" 2>/dev/null; then
+      echo "Process $pid stopped."
+      return 0
+    fi
+    sleep 1
+  done
+
+  echo "Process $pid did not stop in time."
+  return 1
 }
 
 # Function to start the process
@@ -79,32 +93,6 @@ start_process() {
   "$binary_path" &
   local new_pid=$!
   echo "Application started with PID $new_pid"
-  # Update the PID in the .env file
-  update_env_file "$new_pid"
-}
-
-# Function to update the .env file with the new PID
-update_env_file() {
-  local new_pid="$1"
-  # Create a temporary file
-  local temp_file=$(mktemp)
-
-  # Write lines from the original file, replacing the PID line
-  while IFS= read -r line; do
-    if [[ $line == PID=* ]]; then
-      echo "PID=$new_pid" >> "$temp_file"
-    else
-      echo "$line" >> "$temp_file"
-    fi
-  done < "$ENV_FILE"
-
-  # If no PID line existed, append the new one
-  if ! grep -q "^PID=" "$ENV_FILE"; then
-    echo "PID=$new_pid" >> "$temp_file"
-  fi
-
-  # Replace the original .env file with the temporary file
-  mv "$temp_file" "$ENV_FILE"
 }
 
 # Function to build the binary
@@ -182,14 +170,14 @@ if [ ! -f "$BINARY_PATH" ]; then
   build_binary "$BINARY_NAME"
 fi
 
-# Get the PID from the .env file
+# Get the PID of the running application
 PID=$(get_pid)
 
 # Stop the existing process if running
 if [ -n "$PID" ]; then
   stop_process "$PID"
 else
-  echo "No PID found in $ENV_FILE. Starting a new process."
+  echo "No running process found. Starting a new process."
 fi
 
 # Start the process
@@ -1,156 +1,271 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/hiddensetup/w/app/config"
 	"github.com/hiddensetup/w/app/controllers"
+	"github.com/hiddensetup/w/app/logging"
 	"github.com/hiddensetup/w/app/routes"
-	"github.com/joho/godotenv"
+	"github.com/hiddensetup/w/app/store"
 	"go.mau.fi/whatsmeow/store/sqlstore"
-	waLog "go.mau.fi/whatsmeow/util/log"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// shutdownTimeout bounds how long a shutdown waits for requests and webhook
+// deliveries in flight.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
-	if err := godotenv.Load(".env"); err != nil {
-		log.Fatal("Error loading .env file")
+	cfg, err := config.Load(".env", configFile())
+	if err != nil {
+		slog.Error("Loading configuration failed", "error", err)
+		os.Exit(1)
 	}
 
-	binaryName := os.Getenv("BINARY_NAME")
-	if binaryName == "" {
-		log.Fatal("BINARY_NAME not set in .env file")
+	logging.Setup(os.Stdout, cfg.Get().LogFormat)
+	logging.Configure(cfg.Get().LogLevel, cfg.Get().LogRedact)
+
+	if err := runCommand(cfg, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
 	}
+}
 
-	// Check and rename if necessary
-	if err := checkAndRenameBinary(binaryName); err != nil {
-		log.Fatal("Error checking or renaming binary:", err)
+// serve runs the gateway, the default command.
+func serve(cfg *config.Manager) error {
+	if pidFile := cfg.Get().PIDFile; pidFile != "" {
+		if err := writePIDFile(pidFile); err != nil {
+			return fmt.Errorf("writing PID file: %w", err)
+		}
+		defer os.Remove(pidFile)
 	}
 
-	// Write the PID to the .env file
-	if err := updatePIDInEnv(); err != nil {
-		log.Fatal("Error updating PID in .env file:", err)
+	action := run(cfg)
+
+	if action == controllers.ActionRestart {
+		restart()
 	}
 
-	app := fiber.New()
+	return nil
+}
 
-	dbLog := waLog.Stdout("Database", os.Getenv("LOG_LEVEL"), true)
+// openController opens the WhatsApp session store and the gateway database
+// and creates the controller on them. The caller closes appStore.
+func openController(cfg *config.Manager) (controller *controllers.Controller, appStore *store.Store, err error) {
+	dbLog := logging.WA("Database")
 
 	dbContainer, err := sqlstore.New("sqlite3", "file:whatsappstore.db?_foreign_keys=on", dbLog)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
+	}
+
+	appStore, err = store.New(cfg.Get().GatewayDB)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening gateway database: %w", err)
+	}
+
+	return controllers.NewController(dbContainer, appStore, cfg), appStore, nil
+}
+
+// run serves until a signal or an admin request stops it, shuts down
+// gracefully and returns the lifecycle action that was requested.
+func run(cfg *config.Manager) string {
+	settings := cfg.Get()
+
+	app := fiber.New()
+
+	controller, appStore, err := openController(cfg)
+	if err != nil {
+		slog.Error("Opening stores failed", "error", err)
+		os.Exit(1)
 	}
+	defer appStore.Close()
+
+	routes.SetupHealth(app, controller)
+	routes.Setup(app, controller, appStore, cfg)
 
-	controller := controllers.NewController(dbContainer)
-	defer controller.GetClient().Disconnect()
+	var adminApp *fiber.App
+	if settings.AdminListen != "" {
+		adminApp = fiber.New()
+		routes.SetupAdmin(adminApp, controller, appStore, cfg)
 
-	routes.Setup(app, controller)
+		listener, err := adminListener(settings.AdminListen)
+		if err != nil {
+			slog.Error("Opening admin listener failed", "address", settings.AdminListen, "error", err)
+			os.Exit(1)
+		}
+
+		go func() {
+			if err := adminApp.Listener(listener); err != nil {
+				slog.Error("Admin server stopped", "error", err)
+			}
+		}()
+	} else {
+		routes.SetupAdmin(app, controller, appStore, cfg)
+	}
 
-	if os.Getenv("AUTO_LOGIN") == `1` {
+	if settings.AutoLogin {
 		if err := controller.Autologin(); err != nil {
-			log.Fatal("Error auto connect WhatsApp")
+			slog.Error("Auto login failed", "error", err)
+			os.Exit(1)
 		}
 	}
 
-	if err := app.Listen(fmt.Sprintf(":%s", os.Getenv("PORT"))); err != nil {
-		fmt.Println("new error emitted: ", err)
-		log.Fatal("error starting http server")
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- app.Listen(fmt.Sprintf(":%s", settings.Port))
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	action := waitForStop(controller, signals, serverErr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Stop taking requests first, the ones in flight are completed, including
+	// the admin request that asked for the shutdown. Event streams never
+	// complete by themselves.
+	controller.CloseStreams()
+	if err := app.ShutdownWithContext(ctx); err != nil {
+		slog.Error("Shutting down HTTP server failed", "error", err)
+	}
+	if adminApp != nil {
+		if err := adminApp.ShutdownWithContext(ctx); err != nil {
+			slog.Error("Shutting down admin server failed", "error", err)
+		}
 	}
+
+	if err := controller.Close(ctx); err != nil {
+		slog.Error("Closing WhatsApp client failed", "error", err)
+	}
+
+	return action
 }
 
-func updatePIDInEnv() error {
-	pid := os.Getpid()
-	pidStr := fmt.Sprintf("PID=%d\n", pid)
+// restart replaces the process with a fresh copy of the binary. The PID stays
+// the same, so the PID file remains valid.
+func restart() {
+	executable, err := os.Executable()
+	if err != nil {
+		slog.Error("Restarting failed", "error", err)
+		os.Exit(1)
+	}
 
-	// Read the existing .env file and write back to it, excluding old PID lines
-	file, err := os.Open(".env")
-	if err != nil && !os.IsNotExist(err) {
-		return err
+	slog.Info("Restarting")
+	if err := syscall.Exec(executable, os.Args, os.Environ()); err != nil {
+		slog.Error("Restarting failed", "error", err)
+		os.Exit(1)
 	}
+}
 
-	var lines []string
-	if err == nil {
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if !strings.HasPrefix(line, "PID=") {
-				lines = append(lines, line)
+// waitForStop serves until the server fails, a signal other than SIGHUP
+// arrives or an admin requests a lifecycle action. SIGHUP reloads the
+// configuration.
+func waitForStop(controller *controllers.Controller, signals <-chan os.Signal, serverErr <-chan error) string {
+	for {
+		select {
+		case err := <-serverErr:
+			slog.Error("HTTP server failed", "error", err)
+			os.Exit(1)
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if _, err := controller.ReloadConfig(); err != nil {
+					slog.Error("Reloading configuration failed, keeping the active one", "error", err)
+				} else {
+					slog.Info("Configuration reloaded")
+				}
+				continue
 			}
-		}
-		file.Close()
-		if err := scanner.Err(); err != nil {
-			return err
+			slog.Info("Shutting down", "signal", sig.String())
+			return controllers.ActionShutdown
+		case action := <-controller.Lifecycle():
+			slog.Info("Lifecycle action requested", "action", action)
+			return action
 		}
 	}
+}
 
-	// Open the .env file for writing
-	file, err = os.OpenFile(".env", os.O_TRUNC|os.O_WRONLY, 0600)
-	if err != nil {
-		return err
+// configFile is the optional YAML configuration, CONFIG_FILE or config.yaml.
+// Settings in .env and the environment override it.
+func configFile() string {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path
 	}
-	defer file.Close()
 
-	// Write the lines back to the file
-	for _, line := range lines {
-		if _, err := file.WriteString(line + "\n"); err != nil {
-			return err
-		}
-	}
+	return "config.yaml"
+}
 
-	// Write the new PID to the file
-	if _, err := file.WriteString(pidStr); err != nil {
-		return err
+// writePIDFile writes the PID, refusing to when the file names another
+// process that is still running.
+func writePIDFile(path string) error {
+	if pid, ok := readPIDFile(path); ok && pid != os.Getpid() {
+		return fmt.Errorf("%s: already running with PID %d", path, pid)
 	}
 
-	return nil
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
 }
 
-func checkAndRenameBinary(expectedName string) error {
-	currentPath, err := os.Executable()
+// readPIDFile returns the PID in the file if that process is running.
+func readPIDFile(path string) (int, bool) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return err
+		return 0, false
 	}
 
-	currentName := filepath.Base(currentPath)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || !processRunning(pid) {
+		return 0, false
+	}
 
-	if currentName != expectedName {
-		newPath := filepath.Join(filepath.Dir(currentPath), expectedName)
-		if err := os.Rename(currentPath, newPath); err != nil {
-			return err
-		}
+	return pid, true
+}
 
-		// Restart the application with the new name
-		cmd := fmt.Sprintf("%s %s", newPath, strings.Join(os.Args[1:], " "))
-		if err := executeCommand(cmd); err != nil {
-			return err
-		}
-		os.Exit(0) // Exit the current process
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
 	}
 
-	return nil
+	return process.Signal(syscall.Signal(0)) == nil
 }
 
-func executeCommand(cmd string) error {
-	// Use exec.Command to execute the new command
-	parts := strings.Fields(cmd)
-	if len(parts) == 0 {
-		return fmt.Errorf("no command to execute")
+// adminListener listens on a TCP address, or on a Unix socket when the address
+// starts with unix:, e.g. unix:/run/gateway/admin.sock.
+func adminListener(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	// A socket left behind by a previous run would make Listen fail.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
 	}
 
-	command := parts[0]
-	args := parts[1:]
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
 
-	c := exec.Command(command, args...)
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	c.Stdin = os.Stdin
+	if err := os.Chmod(path, 0660); err != nil {
+		listener.Close()
+		return nil, err
+	}
 
-	return c.Run()
+	return listener, nil
 }
@@ -3,9 +3,13 @@
 # Define the path to the .env file
 ENV_FILE=".env"
 
-# Function to get the PID from the .env file
+# Function to get the PID from the PID file the application writes
 get_pid() {
-  grep "^PID=" "$ENV_FILE" | cut -d'=' -f2
+  local pid_file=$(grep "^PID_FILE=" "$ENV_FILE" | cut -d'=' -f2)
+  pid_file=${pid_file:-gateway.pid}
+  if [ -f "$pid_file" ]; then
+    cat "$pid_file"
+  fi
 }
 
 # Function to stop the process
@@ -17,13 +21,22 @@ stop_process() {
   fi
 
   echo "Stopping process with PID $pid..."
-  kill "$pid" 2>/dev/null
-  if [ $? -eq 0 ]; then
-    echo "Process $pid stopped."
-  else
+  if ! kill -TERM "$pid" 2>/dev/null; then
     echo "Failed to stop process $pid or process does not exist."
     return 1
   fi
+
+  # The application shuts down gracefully, give it time to finish.
+  for _ in $(seq 1 35); do
+    if ! kill -0 "$pid" 2>/dev/null; then
+      echo "Process $pid stopped."
+      return 0
+    fi
+    sleep 1
+  done
+
+  echo "Process $pid did not stop in time."
+  return 1
 }
 
 # Main script logic
@@ -33,7 +46,7 @@ PID=$(get_pid)
 if [ -n "$PID" ]; then
   stop_process "$PID"
 else
-  echo "No PID found in $ENV_FILE."
+  echo "No PID file found, the application is not running."
 fi
 
 echo "Operation completed."